@@ -0,0 +1,49 @@
+package mtproto
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// msgIdMaxAhead is how far in the future the server accepts msg_ids
+const msgIdMaxAhead = 30 * time.Second
+
+// serverTime returns the local time corrected by the offset learned from the server
+func (m *MTProto) serverTime() time.Time {
+	return time.Now().Add(time.Duration(atomic.LoadInt64(&m.timeOffset)))
+}
+
+// setServerTime learns the time offset from a msg_id made by the server
+// msg_ids made with a clock running ahead are too high. msg_ids must grow within a session,
+// so newMsgId starts over from the server time in a new session then.
+// It reports whether the new session started, the caller sends the unacknowledged messages again
+func (m *MTProto) setServerTime(serverMsgId int64) bool {
+	server := time.Unix(serverMsgId>>32, int64(uint32(serverMsgId))*int64(time.Second)>>32)
+	atomic.StoreInt64(&m.timeOffset, int64(time.Until(server)))
+
+	m.msgIdMutex.Lock()
+	ahead := m.lastMsgId > messageId(server.Add(msgIdMaxAhead))
+	m.msgIdMutex.Unlock()
+	if !ahead {
+		return false
+	}
+	err := m.newSession()
+	if err != nil {
+		log.Println("setServerTime: new session:", err)
+		return false
+	}
+	return true
+}
+
+// newMsgId returns a msg_id for the server time, greater than the previous one of the session
+func (m *MTProto) newMsgId() int64 {
+	m.msgIdMutex.Lock()
+	defer m.msgIdMutex.Unlock()
+	id := messageId(m.serverTime())
+	if id <= m.lastMsgId {
+		id = m.lastMsgId + 4
+	}
+	m.lastMsgId = id
+	return id
+}
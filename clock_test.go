@@ -0,0 +1,82 @@
+package mtproto
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewMsgId(t *testing.T) {
+	m := &MTProto{}
+	ids := make(chan int64, 1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := int64(0)
+			for j := 0; j < 100; j++ {
+				id := m.newMsgId()
+				if id <= last || id&3 != 0 {
+					t.Errorf("wrong msg_id %x after %x", id, last)
+				}
+				last = id
+				ids <- id
+			}
+		}()
+	}
+	wg.Wait()
+	close(ids)
+	seen := make(map[int64]bool)
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("duplicate msg_id %x", id)
+		}
+		seen[id] = true
+	}
+
+	// the local clock is an hour ahead: msg_id goes back, but in a new session only
+	session := m.sessionId
+	before := m.newMsgId()
+	server := time.Now().Add(-time.Hour)
+	if !m.setServerTime(messageId(server)) || m.sessionId == session || m.lastMsgId != 0 {
+		t.Error("no new session for the lower msg_ids")
+	}
+	id := m.newMsgId()
+	if id >= before || time.Unix(id>>32, 0).Sub(server) > time.Second {
+		t.Errorf("msg_id %x is not made for the server time %v", id, server)
+	}
+
+	// a correction within msgIdMaxAhead keeps the session, msg_id still grows in it
+	session, before = m.sessionId, m.newMsgId()
+	if m.setServerTime(messageId(server.Add(-10*time.Second))) || m.sessionId != session {
+		t.Error("new session for a small correction")
+	}
+	if id = m.newMsgId(); id <= before {
+		t.Errorf("msg_id %x after %x in the same session", id, before)
+	}
+}
+
+func TestBadMsgNotification(t *testing.T) {
+	m := newServiceTestMTProto()
+	resp := make(chan TL, 1)
+	m.msgsIdToAck[100] = packetToSend{TL_help_getConfig{}, resp}
+	m.msgsIdToResp[100] = packetToSend{TL_help_getConfig{}, resp}
+
+	server := time.Now().Add(10 * time.Minute)
+	m.process(messageId(server), 0, TL_crc_bad_msg_notification{100, 1, 16})
+	select {
+	case x := <-m.queueSend:
+		if x.resp != resp {
+			t.Error("response channel is lost")
+		}
+	default:
+		t.Fatal("message is not resent")
+	}
+	if len(m.msgsIdToAck) != 0 || len(m.msgsIdToResp) != 0 {
+		t.Error("old msg_id is still tracked")
+	}
+	if d := m.serverTime().Sub(server); d < -time.Second || d > time.Second {
+		t.Errorf("server time is off by %v", d)
+	}
+}
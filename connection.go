@@ -0,0 +1,196 @@
+package mtproto
+
+import (
+	"log"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+type ConnectionState int
+
+const (
+	CONNECTION_STATE_DISCONNECTED ConnectionState = iota
+	CONNECTION_STATE_CONNECTING
+	CONNECTION_STATE_CONNECTED
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case CONNECTION_STATE_DISCONNECTED:
+		return "DISCONNECTED"
+	case CONNECTION_STATE_CONNECTING:
+		return "CONNECTING"
+	case CONNECTION_STATE_CONNECTED:
+		return "CONNECTED"
+	}
+	return "UNKNOWN"
+}
+
+// ConnectionEvent is sent to MTProto.ConnectionEvents on every state change
+//
+//	Err is the reason of DISCONNECTED state, nil on Disconnect
+type ConnectionEvent struct {
+	State ConnectionState
+	Err   error
+}
+
+// Backoff configures delays between reconnection attempts
+//
+//	delay = min(Min * Factor^attempt, Max), randomized by +-Jitter fraction
+//	MaxRetries 0 means retry forever
+type Backoff struct {
+	Min        time.Duration
+	Max        time.Duration
+	Factor     float64
+	Jitter     float64
+	MaxRetries int
+}
+
+var DefaultBackoff = Backoff{
+	Min:    500 * time.Millisecond,
+	Max:    time.Minute,
+	Factor: 2,
+	Jitter: 0.2,
+}
+
+// Delay returns the pause before the given reconnection attempt (starting at 0)
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Min)
+	for i := 0; i < attempt && d < float64(b.Max); i++ {
+		d *= b.Factor
+	}
+	if d > float64(b.Max) {
+		d = float64(b.Max)
+	}
+	if b.Jitter > 0 {
+		d += d * b.Jitter * (2*rand.Float64() - 1)
+	}
+	if d < 0 {
+		d = 0
+	}
+	return time.Duration(d)
+}
+
+func (m *MTProto) State() ConnectionState {
+	return ConnectionState(atomic.LoadInt32(&m.state))
+}
+
+// setState must not block: events are dropped if nobody reads ConnectionEvents
+func (m *MTProto) setState(state ConnectionState, err error) {
+	atomic.StoreInt32(&m.state, int32(state))
+	select {
+	case m.ConnectionEvents <- ConnectionEvent{state, err}:
+	default:
+	}
+}
+
+// connFailed reports a broken connection to superviseRoutine
+func (m *MTProto) connFailed(err error) {
+	select {
+	case m.connErr <- err:
+	default:
+	}
+}
+
+// superviseRoutine redials the connection after read/write failures
+// and resends every request that is still waiting for an ack or a response
+func (m *MTProto) superviseRoutine() {
+	for {
+		select {
+		case <-m.stopSupervise:
+			return
+		case err := <-m.connErr:
+			if !m.recover(err) {
+				return
+			}
+		case <-m.tempKeyRenewal():
+			if !m.recover(errTempKeyExpiring) {
+				return
+			}
+		}
+	}
+}
+
+func (m *MTProto) recover(err error) bool {
+	m.reconnectMutex.Lock()
+	defer m.reconnectMutex.Unlock()
+
+	select {
+	case <-m.stopSupervise:
+		return false
+	default:
+	}
+	if err == errTempKeyExpiring && !m.tempKeyExpiring() {
+		// renewed by migrate
+		return true
+	}
+
+	m.setState(CONNECTION_STATE_DISCONNECTED, err)
+	_ = m.stopRoutines()
+	// both routines may have failed, one report is enough
+	select {
+	case <-m.connErr:
+	default:
+	}
+
+	var bound chan TL
+	for attempt := 0; ; attempt++ {
+		m.setState(CONNECTION_STATE_CONNECTING, nil)
+		err = m.dial()
+		if err == nil {
+			bound, err = m.bindTempKey()
+			if err == nil {
+				break
+			}
+			m.conn.Close()
+		}
+		log.Println("Reconnect:", err)
+		m.setState(CONNECTION_STATE_DISCONNECTED, err)
+		if m.backoff.MaxRetries > 0 && attempt+1 >= m.backoff.MaxRetries {
+			return false
+		}
+		select {
+		case <-time.After(m.backoff.Delay(attempt)):
+		case <-m.stopSupervise:
+			return false
+		}
+	}
+
+	m.startRoutines()
+	err = m.waitTempKeyBound(bound)
+	if err != nil {
+		// the requests stay inflight until the next attempt
+		log.Println("Reconnect:", err)
+		m.connFailed(err)
+		return true
+	}
+	// the new connection must start with initConnection
+	if m.cdn {
+		atomic.StoreInt32(&m.initPending, 1)
+	} else {
+		m.enqueue(packetToSend{m.initConnectionRequest(TL_help_getConfig{}), nil})
+	}
+	m.resendInflight()
+	m.setState(CONNECTION_STATE_CONNECTED, nil)
+	return true
+}
+
+// resendInflight puts every not acknowledged or not answered request back to the send queue
+func (m *MTProto) resendInflight() {
+	m.mutex.Lock()
+	inflight := make(map[int64]packetToSend, len(m.msgsIdToAck)+len(m.msgsIdToResp))
+	for k, v := range m.msgsIdToAck {
+		inflight[k] = v
+		delete(m.msgsIdToAck, k)
+	}
+	for k, v := range m.msgsIdToResp {
+		inflight[k] = v
+		delete(m.msgsIdToResp, k)
+	}
+	m.mutex.Unlock()
+
+	for _, v := range inflight {
+		m.enqueue(v)
+	}
+}
@@ -0,0 +1,53 @@
+package mtproto
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffDelay(t *testing.T) {
+	b := Backoff{Min: time.Second, Max: 10 * time.Second, Factor: 2}
+	cases := []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{3, 8 * time.Second},
+		{4, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, c := range cases {
+		if d := b.Delay(c.attempt); d != c.delay {
+			t.Errorf("Delay(%d) = %v, want %v", c.attempt, d, c.delay)
+		}
+	}
+
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.Delay(1)
+		if d < time.Second || d > 3*time.Second {
+			t.Fatalf("Delay with jitter out of range: %v", d)
+		}
+	}
+}
+
+func TestInitConnectionError(t *testing.T) {
+	m := newServiceTestMTProto()
+	go func() {
+		x := <-m.queueSend
+		if _, ok := x.msg.(TL_invokeWithLayer); !ok {
+			t.Errorf("sent %#v", x.msg)
+		}
+		x.resp <- TL_rpc_error{500, "INTERNAL"}
+	}()
+	err := m.initConnection()
+	if e, ok := AsRPCError(err); !ok || e.Code != 500 {
+		t.Errorf("got %v", err)
+	}
+
+	// routines stopped by a failed migrate are not stopped again by recover
+	if err = m.stopRoutines(); err != nil {
+		t.Error(err)
+	}
+}
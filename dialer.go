@@ -0,0 +1,199 @@
+package mtproto
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ContextDialer opens connections to DCs, see WithDialer
+// *net.Dialer and golang.org/x/net/proxy dialers implement it
+type ContextDialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewSOCKS5Dialer connects through the SOCKS5 proxy at addr
+// Username/password authentication (RFC 1929) is used if username is not empty
+// forward dials the proxy itself, net.Dialer is used if it is nil
+func NewSOCKS5Dialer(addr, username, password string, forward ContextDialer) ContextDialer {
+	if forward == nil {
+		forward = &net.Dialer{}
+	}
+	return &socks5Dialer{addr, username, password, forward}
+}
+
+type socks5Dialer struct {
+	addr     string
+	username string
+	password string
+	forward  ContextDialer
+}
+
+func (d *socks5Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.forward.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	err = d.connect(conn, address)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SOCKS5: %s", err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// connect makes the handshake and asks the proxy to connect to address
+func (d *socks5Dialer) connect(conn net.Conn, address string) error {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return err
+	}
+
+	method := byte(0x00)
+	greeting := []byte{5, 1, method}
+	if d.username != "" {
+		method = 0x02
+		greeting = []byte{5, 2, 0x00, method}
+	}
+	if _, err = conn.Write(greeting); err != nil {
+		return err
+	}
+	b := make([]byte, 2)
+	if _, err = io.ReadFull(conn, b); err != nil {
+		return err
+	}
+	if b[0] != 5 {
+		return fmt.Errorf("wrong version %d", b[0])
+	}
+	switch b[1] {
+	case 0x00:
+	case 0x02:
+		if d.username == "" {
+			return errors.New("authentication required")
+		}
+		if len(d.username) > 255 || len(d.password) > 255 {
+			return errors.New("username or password is too long")
+		}
+		auth := []byte{1, byte(len(d.username))}
+		auth = append(auth, d.username...)
+		auth = append(auth, byte(len(d.password)))
+		auth = append(auth, d.password...)
+		if _, err = conn.Write(auth); err != nil {
+			return err
+		}
+		if _, err = io.ReadFull(conn, b); err != nil {
+			return err
+		}
+		if b[1] != 0 {
+			return errors.New("authentication failed")
+		}
+	default:
+		return errors.New("no acceptable authentication method")
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("host name is too long")
+		}
+		req = append(req, 3, byte(len(host)))
+		req = append(req, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(req, 1)
+		req = append(req, ip4...)
+	} else {
+		req = append(req, 4)
+		req = append(req, ip.To16()...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err = conn.Write(req); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 4)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[1] != 0 {
+		return fmt.Errorf("connect failed with code %d", reply[1])
+	}
+	// the bound address is not used
+	var size int
+	switch reply[3] {
+	case 1:
+		size = net.IPv4len
+	case 4:
+		size = net.IPv6len
+	case 3:
+		if _, err = io.ReadFull(conn, b[:1]); err != nil {
+			return err
+		}
+		size = int(b[0])
+	default:
+		return fmt.Errorf("wrong address type %d", reply[3])
+	}
+	_, err = io.ReadFull(conn, make([]byte, size+2))
+	return err
+}
+
+// MTProxy is a Telegram proxy, see WithMTProxy
+type MTProxy struct {
+	addr   string
+	secret []byte
+	padded bool
+}
+
+// NewMTProxy parses the proxy secret, 16 bytes in hex
+// Secrets with dd prefix require the padded intermediate framing
+func NewMTProxy(addr, secret string) (*MTProxy, error) {
+	b, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("MTProxy: wrong secret: %s", err)
+	}
+	p := &MTProxy{addr: addr, secret: b}
+	switch {
+	case len(b) == 17 && b[0] == 0xdd:
+		p.secret = b[1:]
+		p.padded = true
+	case len(b) > 0 && b[0] == 0xee:
+		return nil, errors.New("MTProxy: fake TLS secrets are not supported")
+	case len(b) != 16:
+		return nil, fmt.Errorf("MTProxy: wrong secret length %d", len(b))
+	}
+	return p, nil
+}
+
+// transport is obfuscated2 with keys derived from the secret, dc is put to the init header
+func (p *MTProxy) transport(dc int32) NewTransport {
+	inner := NewIntermediateTransport
+	if p.padded {
+		inner = NewPaddedIntermediateTransport
+	}
+	return func(rnd io.Reader) Transport {
+		return &obfuscatedTransport{inner: inner(rnd), secret: p.secret, dc: int16(dc), rnd: rnd}
+	}
+}
+
+// dialAddr returns the address to dial for m.addr, IPv6 addresses from the DC list come without brackets
+func dialAddr(addr string) string {
+	if strings.Count(addr, ":") <= 1 {
+		return addr
+	}
+	idx := strings.LastIndex(addr, ":")
+	return net.JoinHostPort(strings.Trim(addr[:idx], "[]"), addr[idx+1:])
+}
@@ -0,0 +1,171 @@
+package mtproto
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// socks5Server accepts one client with user/secret credentials and connects it to target
+func socks5Server(l net.Listener, target string) error {
+	conn, err := l.Accept()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	b := make([]byte, 256)
+	if _, err = io.ReadFull(conn, b[:2]); err != nil {
+		return err
+	}
+	if _, err = io.ReadFull(conn, b[:b[1]]); err != nil {
+		return err
+	}
+	if !bytes.Contains(b[:2], []byte{2}) {
+		_, _ = conn.Write([]byte{5, 0xff})
+		return errors.New("no auth method")
+	}
+	_, _ = conn.Write([]byte{5, 2})
+	if _, err = io.ReadFull(conn, b[:2]); err != nil {
+		return err
+	}
+	user := make([]byte, b[1])
+	_, _ = io.ReadFull(conn, user)
+	_, _ = io.ReadFull(conn, b[:1])
+	pass := make([]byte, b[0])
+	_, _ = io.ReadFull(conn, pass)
+	if string(user) != "user" || string(pass) != "secret" {
+		_, _ = conn.Write([]byte{1, 1})
+		return errors.New("wrong credentials")
+	}
+	_, _ = conn.Write([]byte{1, 0})
+
+	// connect request for an IPv4 address
+	if _, err = io.ReadFull(conn, b[:10]); err != nil {
+		return err
+	}
+	if b[1] != 1 || b[3] != 1 {
+		return errors.New("wrong request")
+	}
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		return err
+	}
+	defer upstream.Close()
+	_, _ = conn.Write([]byte{5, 0, 0, 1, 127, 0, 0, 1, 0, 0})
+	go io.Copy(upstream, conn)
+	_, err = io.Copy(conn, upstream)
+	return err
+}
+
+func TestSOCKS5Dialer(t *testing.T) {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer echo.Close()
+	go func() {
+		conn, err := echo.Accept()
+		if err == nil {
+			_, _ = io.Copy(conn, conn)
+			conn.Close()
+		}
+	}()
+	proxy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Close()
+	go socks5Server(proxy, echo.Addr().String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	d := NewSOCKS5Dialer(proxy.Addr().String(), "user", "secret", nil)
+	conn, err := d.DialContext(ctx, "tcp", echo.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("ping"))
+	b := make([]byte, 4)
+	if _, err = io.ReadFull(conn, b); err != nil || string(b) != "ping" {
+		t.Errorf("echo: %q, %v", b, err)
+	}
+}
+
+func TestMTProxy(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef"
+	for _, s := range []string{secret, "dd" + secret} {
+		p, err := NewMTProxy("127.0.0.1:0", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.padded != (s[:2] == "dd") {
+			t.Errorf("%s: padded %v", s, p.padded)
+		}
+
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		inner := NewIntermediateTransport(rand.Reader)
+		if p.padded {
+			inner = NewPaddedIntermediateTransport(rand.Reader)
+		}
+		key, _ := hex.DecodeString(secret)
+		done := make(chan error, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				done <- err
+				return
+			}
+			done <- obfuscatedEcho(conn, inner, key, 4)
+		}()
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport := p.transport(4)(rand.Reader)
+		if err = transport.Init(conn); err != nil {
+			t.Fatal(err)
+		}
+		data := bytes.Repeat([]byte{1, 2, 3, 4}, 100)
+		_ = transport.WritePacket(conn, data)
+		got, err := transport.ReadPacket(conn)
+		if err != nil {
+			t.Fatalf("%s: %s", s, err)
+		}
+		if !bytes.Equal(got[:len(data)], data) {
+			t.Errorf("%s: echo mismatch", s)
+		}
+		conn.Close()
+		<-done
+		l.Close()
+	}
+
+	for _, s := range []string{"0123", "ee" + secret, "zz"} {
+		if _, err := NewMTProxy("127.0.0.1:443", s); err == nil {
+			t.Errorf("secret %s accepted", s)
+		}
+	}
+}
+
+func TestDialAddr(t *testing.T) {
+	cases := map[string]string{
+		"149.154.167.50:443":       "149.154.167.50:443",
+		"2001:67c:4e8:f002::a:443": "[2001:67c:4e8:f002::a]:443",
+	}
+	for addr, want := range cases {
+		if got := dialAddr(addr); got != want {
+			t.Errorf("%s: %s, want %s", addr, got, want)
+		}
+	}
+}
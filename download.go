@@ -0,0 +1,351 @@
+package mtproto
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// DownloadPartSize is the size of upload.getFile parts, offsets are aligned to it
+	DownloadPartSize = 512 * 1024
+
+	defaultDownloadWorkers = 4
+	maxCdnReuploads        = 3
+)
+
+// DownloadOptions
+//
+//	Workers is the number of parts fetched concurrently, 4 if zero
+//	Offset resumes a download, it is rounded down to DownloadPartSize
+//	Size is the file size, if zero the download ends with the first short part
+//	Progress is called after every written part with the end of the data written without gaps
+//	 and Size, calls do not overlap
+type DownloadOptions struct {
+	Workers  int
+	Offset   int64
+	Size     int64
+	Progress func(downloaded, total int64)
+}
+
+// DownloadFile writes the file at location to w, every part at its own offset
+// location is *Photo (the largest size), *PhotoSize, *Document, *FileLocation,
+// TL_inputFileLocation or TL_inputDocumentFileLocation
+// Files redirected to CDN DCs are fetched from there and checked against the CDN file hashes
+// Returns the file size, on error the end of the data written without gaps: Offset to resume from
+func (m *MTProto) DownloadFile(ctx context.Context, location interface{}, w io.WriterAt, opts DownloadOptions) (int64, error) {
+	loc, dc, size, err := inputFileLocation(location)
+	if err != nil {
+		return 0, err
+	}
+	if opts.Size == 0 {
+		opts.Size = size
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = defaultDownloadWorkers
+	}
+	offset := opts.Offset - opts.Offset%DownloadPartSize
+	if offset < 0 {
+		offset = 0
+	}
+
+	d := &downloader{
+		m:     m,
+		loc:   loc,
+		dc:    dc,
+		w:     w,
+		opts:  opts,
+		next:  offset,
+		done:  offset,
+		end:   -1,
+		parts: make(map[int64]int64),
+	}
+	if opts.Size > 0 {
+		d.end = opts.Size
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make(chan error, opts.Workers)
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := d.work(ctx)
+			if err != nil {
+				errs <- err
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	// the first error, the others are mostly the cancellation
+	if err, ok := <-errs; ok {
+		return d.done, err
+	}
+	return d.end, nil
+}
+
+// inputFileLocation returns InputFileLocation, its DC (zero for home) and size (zero if unknown)
+func inputFileLocation(location interface{}) (TL, int32, int64, error) {
+	switch l := location.(type) {
+	case *Photo:
+		var largest *PhotoSize
+		for _, s := range l.Sizes {
+			if s == nil || s.Location == nil {
+				continue
+			}
+			if largest == nil || s.Width*s.Height > largest.Width*largest.Height {
+				largest = s
+			}
+		}
+		if largest == nil {
+			return nil, 0, 0, errors.New("DownloadFile: photo has no sizes")
+		}
+		return inputFileLocation(largest)
+	case *PhotoSize:
+		if l.Location == nil {
+			return nil, 0, 0, errors.New("DownloadFile: photo size has no location")
+		}
+		return l.GetInputFileLocation(), l.Location.DC, int64(l.Size), nil
+	case *Document:
+		return l.GetInputFileLocation(), l.DcID, int64(l.Size), nil
+	case *FileLocation:
+		return l.GetInputFileLocation(), l.DC, 0, nil
+	case TL_inputFileLocation, TL_inputDocumentFileLocation:
+		return l.(TL), 0, 0, nil
+	}
+	return nil, 0, 0, fmt.Errorf("DownloadFile: unsupported location %T", location)
+}
+
+type downloader struct {
+	m    *MTProto
+	loc  TL
+	dc   int32
+	w    io.WriterAt
+	opts DownloadOptions
+
+	mutex sync.Mutex
+	next  int64           // offset of the next part to fetch
+	done  int64           // end of the data written without gaps
+	parts map[int64]int64 // sizes of the parts written after done, by offset
+	end   int64           // end of the file, -1 until known
+	cdn   *cdnRedirect
+}
+
+func (d *downloader) work(ctx context.Context) error {
+	for {
+		offset, ok := d.nextPart()
+		if !ok {
+			return nil
+		}
+		data, err := d.part(ctx, offset)
+		if err != nil {
+			return err
+		}
+		if len(data) > 0 {
+			_, err = d.w.WriteAt(data, offset)
+			if err != nil {
+				return err
+			}
+		}
+		d.partDone(offset, int64(len(data)))
+	}
+}
+
+func (d *downloader) nextPart() (int64, bool) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.end >= 0 && d.next >= d.end {
+		return 0, false
+	}
+	offset := d.next
+	d.next += DownloadPartSize
+	return offset, true
+}
+
+func (d *downloader) partDone(offset, n int64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if n < DownloadPartSize && (d.end < 0 || offset+n < d.end) {
+		// a short part is the last one
+		d.end = offset + n
+	}
+	// parts finish out of order, done moves over the written ones
+	d.parts[offset] = n
+	for {
+		size, ok := d.parts[d.done]
+		if !ok {
+			break
+		}
+		delete(d.parts, d.done)
+		d.done += size
+		if size < DownloadPartSize {
+			break
+		}
+	}
+	if d.opts.Progress != nil {
+		d.opts.Progress(d.done, d.opts.Size)
+	}
+}
+
+func (d *downloader) part(ctx context.Context, offset int64) ([]byte, error) {
+	d.mutex.Lock()
+	cdn := d.cdn
+	d.mutex.Unlock()
+	if cdn != nil {
+		return d.cdnPart(ctx, cdn, offset)
+	}
+
+	x, err := d.m.InvokeDC(ctx, d.dc, TL_upload_getFile{d.loc, int32(offset), DownloadPartSize})
+	if err != nil {
+		return nil, err
+	}
+	switch f := x.(type) {
+	case TL_upload_file:
+		return f.Bytes, nil
+	case TL_upload_fileCdnRedirect:
+		d.mutex.Lock()
+		if d.cdn == nil {
+			d.cdn = newCdnRedirect(f)
+		}
+		cdn = d.cdn
+		d.mutex.Unlock()
+		return d.cdnPart(ctx, cdn, offset)
+	}
+	return nil, fmt.Errorf("RPC: %#v", x)
+}
+
+// cdnPart fetches the part from the CDN DC, asking the file DC to reupload it if needed
+func (d *downloader) cdnPart(ctx context.Context, cdn *cdnRedirect, offset int64) ([]byte, error) {
+	conn, err := d.m.cdnConn(ctx, cdn.dc)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; ; i++ {
+		x, err := conn.Invoke(ctx, TL_upload_getCdnFile{cdn.token, int32(offset), DownloadPartSize})
+		if err != nil {
+			return nil, err
+		}
+		switch f := x.(type) {
+		case TL_upload_cdnFile:
+			data, err := cdn.decrypt(f.Bytes, offset)
+			if err != nil {
+				return nil, err
+			}
+			err = d.verify(ctx, cdn, data, offset)
+			if err != nil {
+				return nil, err
+			}
+			return data, nil
+		case TL_upload_cdnFileReuploadNeeded:
+			if i >= maxCdnReuploads {
+				return nil, fmt.Errorf("DownloadFile: CDN part %d is not available", offset)
+			}
+			x, err = d.m.InvokeDC(ctx, d.dc, TL_upload_reuploadCdnFile{cdn.token, f.Request_token})
+			if err != nil {
+				return nil, err
+			}
+			cdn.addHashes(x)
+		default:
+			return nil, fmt.Errorf("RPC: %#v", x)
+		}
+	}
+}
+
+// verify checks data against the CDN file hashes, missing hashes are asked from the file DC
+func (d *downloader) verify(ctx context.Context, cdn *cdnRedirect, data []byte, offset int64) error {
+	for pos := int64(0); pos < int64(len(data)); {
+		h, ok := cdn.hash(offset + pos)
+		if !ok {
+			x, err := d.m.InvokeDC(ctx, d.dc, TL_upload_getCdnFileHashes{cdn.token, int32(offset + pos)})
+			if err != nil {
+				return err
+			}
+			cdn.addHashes(x)
+			h, ok = cdn.hash(offset + pos)
+			if !ok {
+				return fmt.Errorf("DownloadFile: no CDN hash for offset %d", offset+pos)
+			}
+		}
+		if h.Limit <= 0 || pos+int64(h.Limit) > int64(len(data)) {
+			return fmt.Errorf("DownloadFile: wrong CDN hash range %d+%d", h.Offset, h.Limit)
+		}
+		sum := sha256.Sum256(data[pos : pos+int64(h.Limit)])
+		if !bytes.Equal(sum[:], h.Hash) {
+			return fmt.Errorf("DownloadFile: CDN hash mismatch at offset %d", h.Offset)
+		}
+		pos += int64(h.Limit)
+	}
+	return nil
+}
+
+// cdnRedirect is the upload.fileCdnRedirect answer with the hashes known so far
+type cdnRedirect struct {
+	dc    int32
+	token []byte
+	key   []byte
+	iv    []byte
+
+	mutex  sync.Mutex
+	hashes map[int32]TL_cdnFileHash // by offset
+}
+
+func newCdnRedirect(f TL_upload_fileCdnRedirect) *cdnRedirect {
+	cdn := &cdnRedirect{
+		dc:     f.Dc_id,
+		token:  f.File_token,
+		key:    f.Encryption_key,
+		iv:     f.Encryption_iv,
+		hashes: make(map[int32]TL_cdnFileHash),
+	}
+	cdn.addHashes(VectorObject(f.Cdn_file_hashes))
+	return cdn
+}
+
+func (cdn *cdnRedirect) addHashes(x TL) {
+	hashes, ok := x.(VectorObject)
+	if !ok {
+		return
+	}
+	cdn.mutex.Lock()
+	defer cdn.mutex.Unlock()
+	for _, v := range hashes {
+		if h, ok := v.(TL_cdnFileHash); ok {
+			cdn.hashes[h.Offset] = h
+		}
+	}
+}
+
+func (cdn *cdnRedirect) hash(offset int64) (TL_cdnFileHash, bool) {
+	cdn.mutex.Lock()
+	defer cdn.mutex.Unlock()
+	h, ok := cdn.hashes[int32(offset)]
+	return h, ok
+}
+
+// decrypt applies AES-256-CTR, the last 4 bytes of the iv are offset/16 big-endian
+func (cdn *cdnRedirect) decrypt(data []byte, offset int64) ([]byte, error) {
+	block, err := aes.NewCipher(cdn.key)
+	if err != nil {
+		return nil, err
+	}
+	if len(cdn.iv) != aes.BlockSize {
+		return nil, errors.New("DownloadFile: wrong CDN iv")
+	}
+	iv := make([]byte, aes.BlockSize)
+	copy(iv, cdn.iv)
+	binary.BigEndian.PutUint32(iv[12:], uint32(offset/16))
+	out := make([]byte, len(data))
+	cipher.NewCTR(block, iv).XORKeyStream(out, data)
+	return out, nil
+}
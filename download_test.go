@@ -0,0 +1,141 @@
+package mtproto
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestInputFileLocation(t *testing.T) {
+	photo := &Photo{Sizes: []*PhotoSize{
+		{Type: "s", Width: 90, Height: 90, Size: 1000, Location: &FileLocation{DC: 2, VolumeID: 1}},
+		{Type: "x", Width: 800, Height: 600, Size: 50000, Location: &FileLocation{DC: 4, VolumeID: 2}},
+	}}
+	loc, dc, size, err := inputFileLocation(photo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.(TL_inputFileLocation).Volume_id != 2 || dc != 4 || size != 50000 {
+		t.Errorf("photo: %#v dc %d size %d", loc, dc, size)
+	}
+
+	loc, dc, size, err = inputFileLocation(&Document{ID: 7, AccessHash: 8, Version: 3, DcID: 5, Size: 1 << 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loc.(TL_inputDocumentFileLocation).Version != 3 || dc != 5 || size != 1<<20 {
+		t.Errorf("document: %#v dc %d size %d", loc, dc, size)
+	}
+
+	if _, _, _, err = inputFileLocation("file"); err == nil {
+		t.Error("unsupported location accepted")
+	}
+}
+
+func TestCdnRedirectDecrypt(t *testing.T) {
+	key := make([]byte, 32)
+	iv := make([]byte, 16)
+	for i := range key {
+		key[i] = byte(i)
+	}
+	plain := make([]byte, 2*DownloadPartSize)
+	for i := range plain {
+		plain[i] = byte(i * 7)
+	}
+	block, _ := aes.NewCipher(key)
+	encrypted := make([]byte, len(plain))
+	cipher.NewCTR(block, iv).XORKeyStream(encrypted, plain)
+
+	cdn := newCdnRedirect(TL_upload_fileCdnRedirect{Encryption_key: key, Encryption_iv: iv})
+	// the second part is decrypted on its own
+	got, err := cdn.decrypt(encrypted[DownloadPartSize:], DownloadPartSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range got {
+		if got[i] != plain[DownloadPartSize+i] {
+			t.Fatalf("decrypted byte %d mismatch", i)
+		}
+	}
+
+	hashes := make([]TL, 0)
+	for offset := 0; offset < len(plain); offset += 128 * 1024 {
+		sum := sha256.Sum256(plain[offset : offset+128*1024])
+		hashes = append(hashes, TL_cdnFileHash{int32(offset), 128 * 1024, sum[:]})
+	}
+	cdn.addHashes(VectorObject(hashes))
+	d := &downloader{}
+	if err := d.verify(context.Background(), cdn, got, DownloadPartSize); err != nil {
+		t.Error(err)
+	}
+	binary.LittleEndian.PutUint32(got[1000:], 0xdeadbeef)
+	if err := d.verify(context.Background(), cdn, got, DownloadPartSize); err == nil {
+		t.Error("corrupted part verified")
+	}
+}
+
+// writerAt is an in-memory io.WriterAt
+type writerAt struct {
+	mutex sync.Mutex
+	data  []byte
+}
+
+func (w *writerAt) WriteAt(p []byte, off int64) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if end := int(off) + len(p); end > len(w.data) {
+		w.data = append(w.data, make([]byte, end-len(w.data))...)
+	}
+	copy(w.data[off:], p)
+	return len(p), nil
+}
+
+func TestDownloadProgress(t *testing.T) {
+	var progress []int64
+	d := &downloader{
+		opts:  DownloadOptions{Progress: func(done, total int64) { progress = append(progress, done) }},
+		parts: make(map[int64]int64),
+		end:   -1,
+	}
+	// the third and the last part finish before the first one
+	d.partDone(2*DownloadPartSize, DownloadPartSize)
+	d.partDone(3*DownloadPartSize, 10)
+	d.partDone(0, DownloadPartSize)
+	d.partDone(DownloadPartSize, DownloadPartSize)
+	want := []int64{0, 0, DownloadPartSize, 3*DownloadPartSize + 10}
+	if len(progress) != len(want) {
+		t.Fatalf("progress %v, want %v", progress, want)
+	}
+	for i := range want {
+		if progress[i] != want[i] {
+			t.Fatalf("progress %v, want %v", progress, want)
+		}
+	}
+
+	// a failed part stops the resume offset before it
+	m := &MTProto{}
+	m.invoker = func(ctx context.Context, req TL) (TL, error) {
+		offset := int64(req.(TL_upload_getFile).Offset)
+		if offset == DownloadPartSize {
+			return nil, errors.New("part failed")
+		}
+		return TL_upload_file{Bytes: make([]byte, DownloadPartSize)}, nil
+	}
+	var max int64
+	opts := DownloadOptions{
+		Size:     8 * DownloadPartSize,
+		Progress: func(done, total int64) { max = done },
+	}
+	offset, err := m.DownloadFile(context.Background(), TL_inputFileLocation{}, &writerAt{}, opts)
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if offset > DownloadPartSize || max > DownloadPartSize {
+		t.Errorf("resume offset %d, progress %d", offset, max)
+	}
+}
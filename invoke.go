@@ -0,0 +1,149 @@
+package mtproto
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	DefaultRequestTimeout = time.Minute
+
+	maxMigrations = 3
+)
+
+// TimeoutError is returned by Invoke when the context is done before the response arrives
+//
+//	Err is context.DeadlineExceeded or context.Canceled
+type TimeoutError struct {
+	Request TL
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("MTProto: %T: %s", e.Request, e.Err)
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return e.Err == context.DeadlineExceeded
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// ErrResultLost is returned by Invoke when the session is replaced after the server acknowledged the request,
+// but before its result came. The request may have been executed, it is up to the caller to repeat it
+var ErrResultLost = errors.New("MTProto: the result is lost with the old session")
+
+// lostResult is passed to the waiting request instead of the result lost with the old session, see resendUnacked
+type lostResult struct{}
+
+func (e lostResult) encode() []byte { return nil }
+
+// Invoker sends the request and waits for its result
+type Invoker func(ctx context.Context, req TL) (TL, error)
+
+// Middleware wraps an Invoker, see WithMiddleware
+type Middleware func(next Invoker) Invoker
+
+// Invoke sends the request through the middlewares and waits for its result
+// rpc_error answer is returned as *RPCError
+// If ctx is done first, the request is forgotten and *TimeoutError is returned
+// ErrResultLost is returned when a new session started after the request was acknowledged
+func (m *MTProto) Invoke(ctx context.Context, req TL) (TL, error) {
+	if m.invoker == nil {
+		return m.invoke(ctx, req)
+	}
+	return m.invoker(ctx, req)
+}
+
+// invoke is the Invoker at the bottom of the middleware chain
+// On PHONE/NETWORK/USER_MIGRATE_X errors it moves the home DC to X and repeats the request,
+// on FILE/STATS_MIGRATE_X it repeats the request on DC X
+func (m *MTProto) invoke(ctx context.Context, req TL) (TL, error) {
+	for i := 0; ; i++ {
+		x, err := m.send(ctx, req)
+		rpcErr, ok := AsRPCError(err)
+		if !ok || rpcErr.Code != 303 || i >= maxMigrations {
+			return x, err
+		}
+		dc, ok := rpcErr.MigrateDC()
+		if !ok {
+			return x, err
+		}
+		switch rpcErr.Type {
+		case RPC_ERROR_FILE_MIGRATE, RPC_ERROR_STATS_MIGRATE:
+			// the home DC stays, only this request goes to the other DC
+			return m.InvokeDC(ctx, dc, req)
+		}
+		err = m.migrate(dc)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send puts the request to the send queue and waits for the response
+func (m *MTProto) send(ctx context.Context, req TL) (TL, error) {
+	msg, wrapped := req, false
+	if atomic.CompareAndSwapInt32(&m.initPending, 1, 0) {
+		msg, wrapped = m.initConnectionRequest(req), true
+	}
+	resp := make(chan TL, 1)
+	select {
+	case m.queueSend <- packetToSend{msg, resp}:
+	case <-ctx.Done():
+		if wrapped {
+			atomic.StoreInt32(&m.initPending, 1)
+		}
+		return nil, &TimeoutError{req, ctx.Err()}
+	}
+
+	select {
+	case x := <-resp:
+		switch e := x.(type) {
+		case TL_rpc_error:
+			return nil, NewRPCError(e.error_code, e.error_message)
+		case lostResult:
+			return nil, ErrResultLost
+		}
+		return x, nil
+	case <-ctx.Done():
+		m.forget(resp)
+		return nil, &TimeoutError{req, ctx.Err()}
+	}
+}
+
+// invokeSync is Invoke with the default request timeout, for managers without context argument
+func (m *MTProto) invokeSync(req TL) (TL, error) {
+	ctx := context.Background()
+	if m.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.requestTimeout)
+		defer cancel()
+	}
+	return m.Invoke(ctx, req)
+}
+
+// buildInvoker wraps invoke with the middlewares, the first one is the outermost
+func (m *MTProto) buildInvoker() {
+	m.invoker = m.invoke
+	for i := len(m.middlewares) - 1; i >= 0; i-- {
+		m.invoker = m.middlewares[i](m.invoker)
+	}
+}
+
+// forget drops the request waiting on resp, a late response is ignored
+func (m *MTProto) forget(resp chan TL) {
+	m.mutex.Lock()
+	for k, v := range m.msgsIdToResp {
+		if v.resp == resp {
+			delete(m.msgsIdToResp, k)
+			delete(m.msgsIdToAck, k)
+		}
+	}
+	m.mutex.Unlock()
+}
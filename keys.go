@@ -0,0 +1,131 @@
+package mtproto
+
+import (
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"sync"
+)
+
+const (
+	productionDCAddress = "149.154.167.91:443"
+	testDCAddress       = "149.154.167.40:443"
+)
+
+// productionPublicKey is the current key of the Telegram servers, the older telegramPublicKey is kept as well
+const productionPublicKey = `-----BEGIN RSA PUBLIC KEY-----
+MIIBCgKCAQEA6LszBcC1LGzyr992NzE0ieY+BSaOW622Aa9Bd4ZHLl+TuFQ4lo4g
+5nKaMBwK/BIb9xUfg0Q29/2mgIR6Zr9krM7HjuIcCzFvDtr+L0GQjae9H0pRB2OO
+62cECs5HKhT5DZ98K33vmWiLowc621dQuwKWSQKjWf50XYFw42h21P2KXUGyp2y/
++aEyZ+uVgLLQbRA1dEjSDZ2iGRy12Mk5gpYc397aYp438fsJoHIgJ2lgMv5h7WY9
+t6N/byY9Nw9p21Og3AoXSL2q/2IJ1WRUhebgAdGVMlV1fkuOQoEzR7EdpqtQD9Cs
+5+bfo3Nhmcyvk5ftB0WkJ9z6bNZ7yxrP8wIDAQAB
+-----END RSA PUBLIC KEY-----`
+
+// testPublicKey is the key of the Telegram test servers
+const testPublicKey = `-----BEGIN RSA PUBLIC KEY-----
+MIIBCgKCAQEAyMEdY1aR+sCR3ZSJrtztKTKqigvO/vBfqACJLZtS7QMgCGXJ6XIR
+yy7mx66W0/sOFa7/1mAZtEoIokDP3ShoqF4fVNb6XeqgQfaUHd8wJpDWHcR2OFwv
+plUUI1PLTktZ9uW2WE23b+ixNwJjJGwBDJPQEQFBE+vfmH0JP503wr5INS1poWg/
+j25sIWeYPHYeOrFp/eXaqhISP6G+q2IeTaWTXpwZj4LzXq5YOpk4bYEQ6mvRq7D1
+aHWfYmlEGepfaYR8Q0YqvvhYtMte3ITnuSJs171+GDqpdKcSwHnd6FudwGO4pcCO
+j4WcDuXc2CTHgH8gFTNhp/Y8/SpDOhvn9QIDAQAB
+-----END RSA PUBLIC KEY-----`
+
+// KeyRing holds RSA public keys of the servers with their fingerprints,
+// the handshake uses the key matching one of the fingerprints offered in resPQ
+type KeyRing struct {
+	mutex        sync.RWMutex
+	keys         []*rsa.PublicKey
+	fingerprints []uint64
+}
+
+// NewKeyRing returns a key ring with the keys
+func NewKeyRing(keys ...*rsa.PublicKey) *KeyRing {
+	r := new(KeyRing)
+	for _, key := range keys {
+		r.Add(key)
+	}
+	return r
+}
+
+// ProductionKeys returns a new key ring with the public keys of the Telegram servers
+func ProductionKeys() *KeyRing {
+	r := NewKeyRing(&telegramPublicKey)
+	if _, err := r.AddPEM([]byte(productionPublicKey)); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// TestKeys returns a new key ring with the public keys of the Telegram test servers
+func TestKeys() *KeyRing {
+	r := NewKeyRing()
+	if _, err := r.AddPEM([]byte(testPublicKey)); err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// Add adds the key and returns its fingerprint
+func (r *KeyRing) Add(key *rsa.PublicKey) uint64 {
+	fp := publicKeyFingerprint(key)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, v := range r.fingerprints {
+		if v == fp {
+			return fp
+		}
+	}
+	r.keys = append(r.keys, key)
+	r.fingerprints = append(r.fingerprints, fp)
+	return fp
+}
+
+// AddPEM adds every RSA public key of the PEM data and returns their fingerprints
+// PKCS#1 "RSA PUBLIC KEY" and PKIX "PUBLIC KEY" blocks are accepted
+func (r *KeyRing) AddPEM(data []byte) ([]uint64, error) {
+	var keys []*rsa.PublicKey
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		key, err := parsePublicKeyBlock(block)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("RSA: no PEM data")
+	}
+
+	fingerprints := make([]uint64, 0, len(keys))
+	for _, key := range keys {
+		fingerprints = append(fingerprints, r.Add(key))
+	}
+	return fingerprints, nil
+}
+
+// Fingerprints returns the fingerprints of the keys in the order they were added
+func (r *KeyRing) Fingerprints() []uint64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return append([]uint64(nil), r.fingerprints...)
+}
+
+// find returns the first key of the ring matching one of the fingerprints offered in resPQ
+func (r *KeyRing) find(fingerprints []int64) (*rsa.PublicKey, uint64) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for i, fp := range r.fingerprints {
+		for _, v := range fingerprints {
+			if uint64(v) == fp {
+				return r.keys[i], fp
+			}
+		}
+	}
+	return nil, 0
+}
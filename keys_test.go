@@ -0,0 +1,74 @@
+package mtproto
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+)
+
+func TestKeyRing(t *testing.T) {
+	const (
+		productionFP = 0xd09d1d85de64fd85
+		testFP       = 0xb25898df208d2603
+	)
+	if fps := ProductionKeys().Fingerprints(); len(fps) != 2 || fps[0] != telegramPublicKey_FP || fps[1] != productionFP {
+		t.Errorf("production fingerprints %x", fps)
+	}
+	if fps := TestKeys().Fingerprints(); len(fps) != 1 || fps[0] != testFP {
+		t.Errorf("test fingerprints %x", fps)
+	}
+
+	// PKIX and PKCS#1 blocks in one file, the same key is added once
+	der, err := x509.MarshalPKIXPublicKey(&telegramPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := append(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), testPublicKey...)
+	r := NewKeyRing(&telegramPublicKey)
+	fps, err := r.AddPEM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fps) != 2 || fps[0] != telegramPublicKey_FP || fps[1] != testFP || len(r.Fingerprints()) != 2 {
+		t.Errorf("fingerprints %x, ring %x", fps, r.Fingerprints())
+	}
+	if _, err = r.AddPEM([]byte("no keys")); err == nil {
+		t.Error("no error without PEM data")
+	}
+
+	var want uint64 = testFP
+	key, fp := r.find([]int64{1, int64(want)})
+	if key == nil || fp != testFP {
+		t.Errorf("found %x", fp)
+	}
+	if key, _ = r.find([]int64{1, 2}); key != nil {
+		t.Error("found a key for an unknown fingerprint")
+	}
+}
+
+func TestTestServersSession(t *testing.T) {
+	s := testSession()
+	s.TestServers = true
+	if got, err := DecodeSession(s.Encode()); err != nil || !got.TestServers {
+		t.Errorf("decoded %+v, %v", got, err)
+	}
+
+	storage := NewMemorySessionStorage()
+	if err := storage.Save(testSession()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewMTProtoWithStorage(1, "hash", storage, "", 0, WithTestServers()); err == nil {
+		t.Error("production session loaded with the test servers")
+	}
+
+	m, err := NewMTProtoWithStorage(1, "hash", NewMemorySessionStorage(), "", 0, WithTestServers())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.addr != testDCAddress {
+		t.Errorf("address %s", m.addr)
+	}
+	if fps := m.keys.Fingerprints(); len(fps) != 1 || fps[0] != 0xb25898df208d2603 {
+		t.Errorf("fingerprints %x", fps)
+	}
+}
@@ -228,25 +228,22 @@ func NewChannel(input TL) *Channel {
 }
 
 func (m *MTProto) Channels_GetParticipants(channel TL, offset, limit int32) []User {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_channels_getParticipants{
-			Channel: channel,
-			Filter:  TL_channelParticipantsRecent{},
-			Offset:  offset,
-			Limit:   limit,
-		},
-		resp,
+	x, err := m.invokeSync(TL_channels_getParticipants{
+		Channel: channel,
+		Filter:  TL_channelParticipantsRecent{},
+		Offset:  offset,
+		Limit:   limit,
+	})
+	if err != nil {
+		log.Println("Channels_GetParticipants:", err)
+		return []User{}
 	}
-	x := <-resp
 	users := make([]User, 0)
 	switch input := x.(type) {
 	case TL_channels_channelParticipants:
 		for _, u := range input.Users {
 			users = append(users, *NewUser(u))
 		}
-	case TL_rpc_error:
-		fmt.Println(input.error_code, input.error_message)
 	default:
 		fmt.Println(reflect.TypeOf(input).String())
 	}
@@ -254,14 +251,12 @@ func (m *MTProto) Channels_GetParticipants(channel TL, offset, limit int32) []Us
 }
 
 func (m *MTProto) Channels_GetChannels(in []TL) ([]Channel, error) {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_channels_getChannels{
-			Id: in,
-		},
-		resp,
+	x, err := m.invokeSync(TL_channels_getChannels{
+		Id: in,
+	})
+	if err != nil {
+		return []Channel{}, err
 	}
-	x := <-resp
 	channels := make([]Channel, 0, len(in))
 	switch input := x.(type) {
 	case TL_messages_chats:
@@ -269,9 +264,6 @@ func (m *MTProto) Channels_GetChannels(in []TL) ([]Channel, error) {
 			channels = append(channels, *NewChannel(ch))
 		}
 		return channels, nil
-	case TL_rpc_error:
-		fmt.Println(input.error_code, input.error_message)
-		return channels, fmt.Errorf("TL_rpc_error: %d - %s", input.error_code, input.error_message)
 	default:
 		fmt.Println(reflect.TypeOf(input).String())
 		return channels, fmt.Errorf("Don't know how to handle response: %s - %v", reflect.TypeOf(input).String(), input)
@@ -279,17 +271,16 @@ func (m *MTProto) Channels_GetChannels(in []TL) ([]Channel, error) {
 }
 
 func (m *MTProto) Channels_GetFullChannel(channelID int32, accessHash int64) *Channel {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_channels_getFullChannel{
-			Channel: TL_inputChannel{
-				Channel_id:  channelID,
-				Access_hash: accessHash,
-			},
+	x, err := m.invokeSync(TL_channels_getFullChannel{
+		Channel: TL_inputChannel{
+			Channel_id:  channelID,
+			Access_hash: accessHash,
 		},
-		resp,
+	})
+	if err != nil {
+		log.Println("Channels_GetFullChannel:", err)
+		return nil
 	}
-	x := <-resp
 	channel := new(Channel)
 	switch input := x.(type) {
 	case TL_messages_chatFull:
@@ -301,57 +292,46 @@ func (m *MTProto) Channels_GetFullChannel(channelID int32, accessHash int64) *Ch
 }
 
 func (m *MTProto) Channels_JoinChannel(channelID int32, accessHash int64) error {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_channels_joinChannel{
-			Channel: TL_inputChannel{
-				Channel_id:  channelID,
-				Access_hash: accessHash,
-			},
+	x, err := m.invokeSync(TL_channels_joinChannel{
+		Channel: TL_inputChannel{
+			Channel_id:  channelID,
+			Access_hash: accessHash,
 		},
-		resp,
+	})
+	if err != nil {
+		return err
 	}
-	x := <-resp
-	switch input := x.(type) {
-	case TL_rpc_error:
-		return fmt.Errorf("TL_rpc_error: %d - %s", input.error_code, input.error_message)
-	default:
-		// log.Println(reflect.TypeOf(input))
+	if __debug&DEBUG_LEVEL_NETWORK != 0 {
+		log.Println(reflect.TypeOf(x))
 	}
 	return nil
 }
 
 func (m *MTProto) Channels_LeaveChannel(channelID int32, accessHash int64) error {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_channels_leaveChannel{
-			Channel: TL_inputChannel{
-				Channel_id:  channelID,
-				Access_hash: accessHash,
-			},
+	x, err := m.invokeSync(TL_channels_leaveChannel{
+		Channel: TL_inputChannel{
+			Channel_id:  channelID,
+			Access_hash: accessHash,
 		},
-		resp,
+	})
+	if err != nil {
+		return err
 	}
-	x := <-resp
-	switch input := x.(type) {
-	case TL_rpc_error:
-		return fmt.Errorf("TL_rpc_error: %d - %s", input.error_code, input.error_message)
-	default:
-		// log.Println(reflect.TypeOf(input))
+	if __debug&DEBUG_LEVEL_NETWORK != 0 {
+		log.Println(reflect.TypeOf(x))
 	}
 	return nil
 }
 
 func (m *MTProto) Channels_GetMessages(channel TL, ids []int32) []Message {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_channels_getMessages{
-			Channel: channel,
-			Id:      ids,
-		},
-		resp,
+	x, err := m.invokeSync(TL_channels_getMessages{
+		Channel: channel,
+		Id:      ids,
+	})
+	if err != nil {
+		log.Println("Channels_GetMessages:", err)
+		return []Message{}
 	}
-	x := <-resp
 	messages := make([]Message, 0, len(ids))
 	switch input := x.(type) {
 	case TL_messages_messages:
@@ -379,9 +359,6 @@ func (m *MTProto) Channels_GetMessages(channel TL, ids []int32) []Message {
 			}
 		}
 		return messages
-	case TL_rpc_error:
-		fmt.Println(input.error_code, input.error_message)
-		return messages
 	default:
 		fmt.Println(reflect.TypeOf(input).String())
 		return messages
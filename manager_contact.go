@@ -46,12 +46,10 @@ func NewContact(in TL) (contact *Contact) {
 }
 
 func (m *MTProto) Contacts_ResolveUserName(name string) ([]Channel, []Chat, []User, error) {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{TL_contacts_resolveUsername{
-		name},
-		resp,
+	x, err := m.invokeSync(TL_contacts_resolveUsername{name})
+	if err != nil {
+		return []Channel{}, []Chat{}, []User{}, err
 	}
-	x := <-resp
 
 	peer, ok := x.(TL_contacts_resolvedPeer)
 	if !ok {
@@ -93,12 +91,10 @@ func (m *MTProto) Contacts_ResolveUserName(name string) ([]Channel, []Chat, []Us
 }
 
 func (m *MTProto) Contacts_GetContacts(hash int32) ([]Contact, []User, error) {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{TL_contacts_getContacts{
-		hash},
-		resp,
+	x, err := m.invokeSync(TL_contacts_getContacts{hash})
+	if err != nil {
+		return []Contact{}, []User{}, err
 	}
-	x := <-resp
 	list, ok := x.(TL_contacts_contacts)
 	if !ok {
 		log.Println(fmt.Sprintf("RPC: %#v", x))
@@ -126,14 +122,13 @@ func (m *MTProto) Contacts_GetContacts(hash int32) ([]Contact, []User, error) {
 }
 
 func (m *MTProto) Contacts_ImportContacts(contacts []TL) {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_contacts_importContacts{
-			contacts,
-		},
-		resp,
+	x, err := m.invokeSync(TL_contacts_importContacts{
+		contacts,
+	})
+	if err != nil {
+		log.Println("Contacts_ImportContacts:", err)
+		return
 	}
-	x := <-resp
 	switch r := x.(type) {
 	case TL_contacts_importedContacts:
 		//TODO:: must do something with response
@@ -72,18 +72,16 @@ func (d *Dialog) GetInputPeer() TL {
 }
 
 func (m *MTProto) Messages_GetDialogs(offsetID, offsetDate, limit int32, offsetInputPeer TL) ([]Dialog, int, error) {
-	resp := make(chan TL, 1)
 	for {
-		m.queueSend <- packetToSend{
-			TL_messages_getDialogs{
-				Offset_id:   offsetID,
-				Offset_date: offsetDate,
-				Limit:       limit,
-				Offset_peer: offsetInputPeer,
-			},
-			resp,
+		x, err := m.invokeSync(TL_messages_getDialogs{
+			Offset_id:   offsetID,
+			Offset_date: offsetDate,
+			Limit:       limit,
+			Offset_peer: offsetInputPeer,
+		})
+		if err != nil {
+			return []Dialog{}, 0, err
 		}
-		x := <-resp
 		mMessages := make(map[int32]*Message)
 		mChats := make(map[int32]*Chat)
 		mChannels := make(map[int32]*Channel)
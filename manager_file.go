@@ -6,24 +6,19 @@ import (
 )
 
 func (m *MTProto) Upload_GetFile(in TL, offset, limit int32) []byte {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_upload_getFile{
-			Offset:   offset,
-			Limit:    limit,
-			Location: in,
-		},
-		resp,
+	x, err := m.invokeSync(TL_upload_getFile{
+		Offset:   offset,
+		Limit:    limit,
+		Location: in,
+	})
+	if err != nil {
+		log.Println("Upload_GetFile:", err)
+		return []byte{}
 	}
-	x := <-resp
 	switch f := x.(type) {
 	case TL_upload_file:
 		return f.Bytes
 	case TL_upload_fileCdnRedirect:
-	case TL_rpc_error:
-		if f.error_code == 303 {
-			// Migrate Code
-		}
 	default:
 		log.Println(reflect.TypeOf(f).String(), f)
 	}
@@ -31,26 +26,25 @@ func (m *MTProto) Upload_GetFile(in TL, offset, limit int32) []byte {
 }
 
 func (m *MTProto) Upload_GetCdnFile(fileToken []byte, offset, limit int32) []byte {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_upload_getCdnFile{
-			fileToken,
-			offset,
-			limit,
-		},
-		resp,
+	x, err := m.invokeSync(TL_upload_getCdnFile{
+		fileToken,
+		offset,
+		limit,
+	})
+	if err != nil {
+		log.Println("Upload_GetCdnFile:", err)
+		return []byte{}
 	}
-	x := <-resp
 	switch f := x.(type) {
 	case TL_upload_cdnFileReuploadNeeded:
-		m.queueSend <- packetToSend{
-			TL_upload_reuploadCdnFile{
-				Request_token: f.Request_token,
-				File_token:    fileToken,
-			},
-			resp,
+		z, err := m.invokeSync(TL_upload_reuploadCdnFile{
+			Request_token: f.Request_token,
+			File_token:    fileToken,
+		})
+		if err != nil {
+			log.Println("Upload_GetCdnFile:", err)
+			return []byte{}
 		}
-		z := <-resp
 		switch reflect.TypeOf(z).Kind() {
 		case reflect.Slice:
 			s := reflect.ValueOf(z)
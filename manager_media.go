@@ -0,0 +1,149 @@
+package mtproto
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Messages_SendPhoto sends a photo with caption
+// photo is an uploaded file (TL_inputFile from UploadFile) or an existing *Photo
+// Albums are not supported by the layer
+func (m *MTProto) Messages_SendPhoto(peer TL, photo interface{}, caption string, replyTo int32) (*Message, error) {
+	var media TL
+	switch p := photo.(type) {
+	case TL_inputFile, TL_inputFileBig:
+		media = TL_inputMediaUploadedPhoto{File: p.(TL), Caption: caption}
+	case *Photo:
+		media = TL_inputMediaPhoto{
+			Id:      TL_inputPhoto{Id: p.ID, Access_hash: p.AccessHash},
+			Caption: caption,
+		}
+	default:
+		return nil, fmt.Errorf("Messages_SendPhoto: unsupported photo %T", photo)
+	}
+	return m.Messages_SendMedia(peer, media, replyTo)
+}
+
+// Messages_SendDocument sends a document with caption
+// document is an uploaded file (TL_inputFile/TL_inputFileBig from UploadFile) or an existing *Document,
+// mimeType and attributes are used for uploaded files only, see NewDocumentAttributeFilename and others
+func (m *MTProto) Messages_SendDocument(peer TL, document interface{}, mimeType, caption string, attributes []TL, replyTo int32) (*Message, error) {
+	var media TL
+	switch d := document.(type) {
+	case TL_inputFile, TL_inputFileBig:
+		if attributes == nil {
+			attributes = []TL{}
+		}
+		media = TL_inputMediaUploadedDocument{
+			File:       d.(TL),
+			Mime_type:  mimeType,
+			Attributes: attributes,
+			Caption:    caption,
+		}
+	case *Document:
+		media = TL_inputMediaDocument{
+			Id:      TL_inputDocument{Id: d.ID, Access_hash: d.AccessHash},
+			Caption: caption,
+		}
+	default:
+		return nil, fmt.Errorf("Messages_SendDocument: unsupported document %T", document)
+	}
+	return m.Messages_SendMedia(peer, media, replyTo)
+}
+
+func (m *MTProto) Messages_SendContact(peer TL, phone, firstName, lastName string, replyTo int32) (*Message, error) {
+	return m.Messages_SendMedia(peer, TL_inputMediaContact{
+		Phone_number: phone,
+		First_name:   firstName,
+		Last_name:    lastName,
+	}, replyTo)
+}
+
+func (m *MTProto) Messages_SendGeoPoint(peer TL, lat, long float64, replyTo int32) (*Message, error) {
+	return m.Messages_SendMedia(peer, TL_inputMediaGeoPoint{
+		Geo_point: TL_inputGeoPoint{Lat: lat, Long: long},
+	}, replyTo)
+}
+
+// Messages_SendMedia sends InputMedia and returns the new message
+func (m *MTProto) Messages_SendMedia(peer, media TL, replyTo int32) (*Message, error) {
+	randomId, err := m.randomInt64()
+	if err != nil {
+		return nil, err
+	}
+	req := TL_messages_sendMedia{
+		Peer:      peer,
+		Media:     media,
+		Random_id: randomId,
+	}
+	if replyTo != 0 {
+		req.Flags |= 1 << 0
+		req.Reply_to_msg_id = replyTo
+	}
+	x, err := m.invokeSync(req)
+	if err != nil {
+		return nil, err
+	}
+	return sentMessage(x)
+}
+
+// sentMessage finds the new message in the Updates answer of a send request
+func sentMessage(x TL) (*Message, error) {
+	var updates []TL
+	switch u := x.(type) {
+	case TL_updates:
+		updates = u.Updates
+	case TL_updatesCombined:
+		updates = u.Updates
+	default:
+		return nil, fmt.Errorf("RPC: %#v", x)
+	}
+	for _, u := range updates {
+		var msg TL
+		switch u := u.(type) {
+		case TL_updateNewMessage:
+			msg = u.Message
+		case TL_updateNewChannelMessage:
+			msg = u.Message
+		default:
+			continue
+		}
+		if message := NewMessage(msg); message != nil {
+			return message, nil
+		}
+	}
+	return nil, errors.New("No new message in updates")
+}
+
+func NewDocumentAttributeFilename(name string) TL {
+	return TL_documentAttributeFilename{File_name: name}
+}
+
+// NewDocumentAttributeAudio describes music, or a voice message if voice is set
+func NewDocumentAttributeAudio(duration int32, title, performer string, voice bool) TL {
+	a := TL_documentAttributeAudio{Duration: duration, Title: title, Performer: performer}
+	if title != "" {
+		a.Flags |= 1 << 0
+	}
+	if performer != "" {
+		a.Flags |= 1 << 1
+	}
+	if voice {
+		a.Flags |= 1 << 10
+	}
+	return a
+}
+
+// NewDocumentAttributeVideo describes a video, or a round video message if round is set
+func NewDocumentAttributeVideo(duration, w, h int32, round bool) TL {
+	v := TL_documentAttributeVideo{Duration: duration, W: w, H: h}
+	if round {
+		v.Flags |= 1 << 0
+	}
+	return v
+}
+
+// NewDocumentAttributeSticker describes a sticker not belonging to a sticker set, alt is its emoji
+func NewDocumentAttributeSticker(alt string) TL {
+	return TL_documentAttributeSticker{Alt: alt, Stickerset: TL_inputStickerSetEmpty{}}
+}
@@ -0,0 +1,77 @@
+package mtproto
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestMessagesSendMedia(t *testing.T) {
+	var sent TL_messages_sendMedia
+	m := &MTProto{}
+	m.invoker = func(ctx context.Context, req TL) (TL, error) {
+		sent = req.(TL_messages_sendMedia)
+		return TL_updates{Updates: []TL{
+			TL_updateMessageID{Id: 10, Random_id: sent.Random_id},
+			TL_updateNewMessage{Message: TL_message{
+				Id:    10,
+				To_id: TL_peerUser{User_id: 1},
+				Media: TL_messageMediaGeo{TL_geoPoint{Long: 2, Lat: 1}},
+			}},
+		}}, nil
+	}
+
+	msg, err := m.Messages_SendGeoPoint(TL_inputPeerSelf{}, 1, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	geo, ok := msg.Media.(*MessageMediaGeo)
+	if msg.ID != 10 || !ok || geo.Geo.Latitude != 1 || geo.Geo.Longtitude != 2 {
+		t.Errorf("got %#v", msg)
+	}
+	if sent.Flags != 0 {
+		t.Errorf("flags %d, want 0", sent.Flags)
+	}
+
+	file := TL_inputFile{Id: 1, Parts: 1, Name: "a.ogg"}
+	msg, err = m.Messages_SendDocument(TL_inputPeerSelf{}, file, "audio/ogg", "",
+		[]TL{NewDocumentAttributeAudio(3, "", "", true), NewDocumentAttributeFilename("a.ogg")}, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.ID != 10 {
+		t.Errorf("got %#v", msg)
+	}
+	if sent.Flags != 1 || sent.Reply_to_msg_id != 5 {
+		t.Errorf("flags %d reply %d", sent.Flags, sent.Reply_to_msg_id)
+	}
+
+	// optional fields are encoded only with their flags
+	audio := NewEncodeBuf(16)
+	audio.UInt(crc_documentAttributeAudio)
+	audio.Int(1 << 10)
+	audio.Int(3)
+	if x := NewDocumentAttributeAudio(3, "", "", true).encode(); !bytes.Equal(x, audio.buf) {
+		t.Errorf("audio attribute %x, want %x", x, audio.buf)
+	}
+
+	want := NewEncodeBuf(256)
+	want.UInt(crc_messages_sendMedia)
+	want.Int(1)
+	want.UInt(crc_inputPeerSelf)
+	want.Int(5)
+	want.UInt(crc_inputMediaUploadedDocument)
+	want.Int(0)
+	want.Bytes(file.encode())
+	want.String("audio/ogg")
+	want.UInt(crc_vector)
+	want.Int(2)
+	want.Bytes(audio.buf)
+	want.UInt(crc_documentAttributeFilename)
+	want.String("a.ogg")
+	want.String("")
+	want.Long(sent.Random_id)
+	if x := sent.encode(); !bytes.Equal(x, want.buf) {
+		t.Errorf("messages.sendMedia %x, want %x", x, want.buf)
+	}
+}
@@ -3,7 +3,6 @@ package mtproto
 import (
 	"fmt"
 	"log"
-	"math/rand"
 	"reflect"
 )
 
@@ -89,6 +88,9 @@ type MessageMediaDocument struct {
 	Caption  string
 	Document Document
 }
+type MessageMediaGeo struct {
+	Geo GeoPoint
+}
 type MessageReplyMarkup struct {
 }
 
@@ -264,6 +266,7 @@ func NewMessageForwardHeader(input TL) (fwd *MessageForwardHeader) {
 //	1. TL_messageMediaPhoto
 //	2. TL_messageMediaContact
 //	3. TL_messageMediaDocument
+//	4. TL_messageMediaGeo
 //
 func NewMessageMedia(input TL) interface{} {
 	switch x := input.(type) {
@@ -284,6 +287,12 @@ func NewMessageMedia(input TL) interface{} {
 		mm.Caption = x.Caption
 		mm.Document = *NewDocument(x.Document)
 		return mm
+	case TL_messageMediaGeo:
+		mm := new(MessageMediaGeo)
+		if g, ok := x.Geo.(TL_geoPoint); ok {
+			mm.Geo = GeoPoint{float32(g.Long), float32(g.Lat)}
+		}
+		return mm
 	case TL_messageMediaWebPage:
 		// TODO:: implement it
 	default:
@@ -293,20 +302,26 @@ func NewMessageMedia(input TL) interface{} {
 }
 
 func (m *MTProto) Messages_SendMessage(text string, peer TL, reply_to int32) (interface{}, error) {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_messages_sendMessage{
-			0,
-			peer,
-			reply_to,
-			text,
-			rand.Int63(),
-			TL_null{},
-			nil,
-		},
-		resp,
+	randomId, err := m.randomInt64()
+	if err != nil {
+		return nil, err
+	}
+	var flags int32
+	if reply_to != 0 {
+		flags |= 1 << 0
+	}
+	x, err := m.invokeSync(TL_messages_sendMessage{
+		flags,
+		peer,
+		reply_to,
+		text,
+		randomId,
+		TL_null{},
+		nil,
+	})
+	if err != nil {
+		return nil, err
 	}
-	x := <-resp
 	switch r := x.(type) {
 	default:
 		log.Println(reflect.TypeOf(r))
@@ -317,20 +332,17 @@ func (m *MTProto) Messages_SendMessage(text string, peer TL, reply_to int32) (in
 }
 
 func (m *MTProto) Messages_ImportChatInvite(hash string) *Chat {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_messages_importChatInvite{
-			hash,
-		},
-		resp,
+	x, err := m.invokeSync(TL_messages_importChatInvite{
+		hash,
+	})
+	if err != nil {
+		log.Println("Messages_ImportChatInvite:", err)
+		return nil
 	}
-	x := <-resp
 	switch r := x.(type) {
 	case TL_updates:
 		chat := NewChat(r.Chats[0])
 		return chat
-	case TL_rpc_error:
-		log.Println(r.error_code, r.error_message)
 	default:
 		log.Println(reflect.TypeOf(r))
 	}
@@ -338,20 +350,18 @@ func (m *MTProto) Messages_ImportChatInvite(hash string) *Chat {
 }
 
 func (m *MTProto) Messages_GetHistory(inputPeer TL, offs_id, offs_date, add_offs, limit, min_id, max_id int32) ([]Message, int32, error) {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_messages_getHistory{
-			Offset_id:   offs_id,
-			Offset_date: offs_date,
-			Add_offset:  add_offs,
-			Peer:        inputPeer,
-			Limit:       limit,
-			Max_id:      max_id,
-			Min_id:      min_id,
-		},
-		resp,
+	x, err := m.invokeSync(TL_messages_getHistory{
+		Offset_id:   offs_id,
+		Offset_date: offs_date,
+		Add_offset:  add_offs,
+		Peer:        inputPeer,
+		Limit:       limit,
+		Max_id:      max_id,
+		Min_id:      min_id,
+	})
+	if err != nil {
+		return []Message{}, 0, err
 	}
-	x := <-resp
 	messages := make([]Message, 0, 20)
 	switch input := x.(type) {
 	case TL_messages_messages:
@@ -378,9 +388,6 @@ func (m *MTProto) Messages_GetHistory(inputPeer TL, offs_id, offs_date, add_offs
 			}
 		}
 		return messages, input.Count, nil
-	case TL_rpc_error:
-		fmt.Println(input.error_message, input.error_code)
-		return messages, 0, fmt.Errorf("TL_rpc_error: %d %s", input.error_code, input.error_message)
 	default:
 		fmt.Println(reflect.TypeOf(input).String())
 		return messages, 0, nil
@@ -389,14 +396,12 @@ func (m *MTProto) Messages_GetHistory(inputPeer TL, offs_id, offs_date, add_offs
 }
 
 func (m *MTProto) Messages_GetChats(chatIDs []int32) ([]Chat, error) {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_messages_getChats{
-			Id: chatIDs,
-		},
-		resp,
+	x, err := m.invokeSync(TL_messages_getChats{
+		Id: chatIDs,
+	})
+	if err != nil {
+		return []Chat{}, err
 	}
-	x := <-resp
 	chats := make([]Chat, 0, len(chatIDs))
 	switch input := x.(type) {
 	case TL_messages_chats:
@@ -404,9 +409,6 @@ func (m *MTProto) Messages_GetChats(chatIDs []int32) ([]Chat, error) {
 			chats = append(chats, *NewChat(ch))
 		}
 		return chats, nil
-	case TL_rpc_error:
-		fmt.Println(input.error_code, input.error_message)
-		return chats, fmt.Errorf("TL_rpc_error: %d - %s", input.error_code, input.error_message)
 	default:
 		fmt.Println(reflect.TypeOf(input).String())
 		return chats, fmt.Errorf("Don't know how to handle response: %s - %v", reflect.TypeOf(input).String(), input)
@@ -414,14 +416,13 @@ func (m *MTProto) Messages_GetChats(chatIDs []int32) ([]Chat, error) {
 }
 
 func (m *MTProto) Messages_GetFullChat(chatID int32) *Chat {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_messages_getFullChat{
-			Chat_id: chatID,
-		},
-		resp,
+	x, err := m.invokeSync(TL_messages_getFullChat{
+		Chat_id: chatID,
+	})
+	if err != nil {
+		log.Println("Messages_GetFullChat:", err)
+		return new(Chat)
 	}
-	x := <-resp
 	chat := new(Chat)
 	switch input := x.(type) {
 	case TL_messages_chatFull:
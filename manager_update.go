@@ -161,12 +161,10 @@ func NewUpdate(input TL) *Update {
 }
 
 func (m *MTProto) Updates_GetState() (*UpdateState, error) {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_updates_getState{},
-		resp,
+	x, err := m.invokeSync(TL_updates_getState{})
+	if err != nil {
+		return nil, err
 	}
-	x := <-resp
 	switch x.(type) {
 	case TL_updates_state:
 		return NewUpdateState(x), nil
@@ -177,18 +175,16 @@ func (m *MTProto) Updates_GetState() (*UpdateState, error) {
 }
 
 func (m *MTProto) Updates_GetDifference(pts, qts, date int32) (*UpdateDifference, error) {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_updates_getDifference{
-			Flags:           1,
-			Pts:             pts,
-			Pts_total_limit: 100,
-			Qts:             qts,
-			Date:            date,
-		},
-		resp,
+	x, err := m.invokeSync(TL_updates_getDifference{
+		Flags:           1,
+		Pts:             pts,
+		Pts_total_limit: 100,
+		Qts:             qts,
+		Date:            date,
+	})
+	if err != nil {
+		return nil, err
 	}
-	x := <-resp
 	updateDifference := new(UpdateDifference)
 	switch u := x.(type) {
 	case TL_updates_differenceEmpty:
@@ -263,17 +259,16 @@ func (m *MTProto) Updates_GetDifference(pts, qts, date int32) (*UpdateDifference
 }
 
 func (m *MTProto) Updates_GetChannelDifference(inputChannel TL, pts, limit int32) *ChannelUpdateDifference {
-	resp := make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_updates_getChannelDifference{
-			Channel: inputChannel,
-			Filter:  TL_channelMessagesFilterEmpty{},
-			Pts:     pts,
-			Limit:   limit,
-		},
-		resp,
+	x, err := m.invokeSync(TL_updates_getChannelDifference{
+		Channel: inputChannel,
+		Filter:  TL_channelMessagesFilterEmpty{},
+		Pts:     pts,
+		Limit:   limit,
+	})
+	if err != nil {
+		log.Println("Updates_GetChannelDifference:", err)
+		return new(ChannelUpdateDifference)
 	}
-	x := <-resp
 	updateDifference := new(ChannelUpdateDifference)
 	switch u := x.(type) {
 	case TL_updates_channelDifferenceEmpty:
@@ -313,8 +308,6 @@ func (m *MTProto) Updates_GetChannelDifference(inputChannel TL, pts, limit int32
 
 		}
 
-	case TL_rpc_error:
-		log.Println("Update_GetChannelDiffrence::", u.error_code, u.error_message)
 	}
 	return updateDifference
 }
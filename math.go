@@ -1,12 +1,21 @@
 package mtproto
 
 import (
+	"bytes"
 	"crypto/aes"
+	crand "crypto/rand"
 	"crypto/rsa"
 	sha1lib "crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
 	"errors"
+	"fmt"
+	"io"
 	"math/big"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -28,12 +37,44 @@ func sha1(data []byte) []byte {
 	return r[:]
 }
 
-func doRSAencrypt(em []byte) []byte {
+// parsePublicKey reads an RSA public key from PEM, both PKCS#1 "RSA PUBLIC KEY" and PKIX "PUBLIC KEY" blocks are accepted
+func parsePublicKey(data []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("RSA: no PEM data")
+	}
+	return parsePublicKeyBlock(block)
+}
+
+func parsePublicKeyBlock(block *pem.Block) (*rsa.PublicKey, error) {
+	if key, err := x509.ParsePKCS1PublicKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("RSA: not an RSA key: %T", key)
+	}
+	return rsaKey, nil
+}
+
+// publicKeyFingerprint is the lower 64 bits of SHA1(n, e serialized as TL bytes)
+func publicKeyFingerprint(key *rsa.PublicKey) uint64 {
+	x := NewEncodeBuf(300)
+	x.StringBytes(key.N.Bytes())
+	x.StringBytes(big.NewInt(int64(key.E)).Bytes())
+	return binary.LittleEndian.Uint64(sha1(x.buf)[12:20])
+}
+
+func doRSAencrypt(em []byte, key *rsa.PublicKey) []byte {
 	z := make([]byte, 255)
 	copy(z, em)
 
 	c := new(big.Int)
-	c.Exp(new(big.Int).SetBytes(z), big.NewInt(int64(telegramPublicKey.E)), telegramPublicKey.N)
+	c.Exp(new(big.Int).SetBytes(z), big.NewInt(int64(key.E)), key.N)
 
 	res := make([]byte, 256)
 	copy(res, c.Bytes())
@@ -120,11 +161,107 @@ func splitPQ(pq *big.Int) (p1, p2 *big.Int) {
 	return
 }
 
-func makeGAB(g int32, g_a, dh_prime *big.Int) (b, g_b, g_ab *big.Int) {
-	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+// dhSafetyMargin bounds g_a and g_b: 2^(2048-64) <= g_a <= dh_prime - 2^(2048-64)
+var dhSafetyMargin = new(big.Int).Lsh(big.NewInt(1), 2048-64)
+
+// knownPrimes caches the dh_prime values already checked to be safe primes,
+// the server sends the same prime on every handshake
+var (
+	knownPrimes      = make(map[string]bool)
+	knownPrimesMutex sync.Mutex
+)
+
+// checkDHParams checks that dh_prime is a safe 2048-bit prime and g generates
+// its subgroup of prime order (dh_prime-1)/2
+// https://core.telegram.org/mtproto/auth_key#presenting-proof-of-work-server-authentication
+func checkDHParams(g int32, dh_prime *big.Int) error {
+	if dh_prime.BitLen() != 2048 {
+		return fmt.Errorf("Handshake: dh_prime is %d bits long", dh_prime.BitLen())
+	}
+	if !checkGenerator(g, dh_prime) {
+		return fmt.Errorf("Handshake: Wrong g %d", g)
+	}
+	if !safePrime(dh_prime) {
+		return errors.New("Handshake: dh_prime is not a safe prime")
+	}
+	return nil
+}
+
+// checkGenerator checks that g is a quadratic residue modulo dh_prime
+func checkGenerator(g int32, dh_prime *big.Int) bool {
+	mod := func(n int64) int64 {
+		return new(big.Int).Mod(dh_prime, big.NewInt(n)).Int64()
+	}
+	switch g {
+	case 2:
+		return mod(8) == 7
+	case 3:
+		return mod(3) == 2
+	case 4:
+		return true
+	case 5:
+		r := mod(5)
+		return r == 1 || r == 4
+	case 6:
+		r := mod(24)
+		return r == 19 || r == 23
+	case 7:
+		r := mod(7)
+		return r == 3 || r == 5 || r == 6
+	}
+	return false
+}
+
+// safePrime reports whether both p and (p-1)/2 are prime
+func safePrime(p *big.Int) bool {
+	key := string(p.Bytes())
+	knownPrimesMutex.Lock()
+	known := knownPrimes[key]
+	knownPrimesMutex.Unlock()
+	if known {
+		return true
+	}
+
+	if !p.ProbablyPrime(30) || !new(big.Int).Rsh(p, 1).ProbablyPrime(30) {
+		return false
+	}
+	knownPrimesMutex.Lock()
+	knownPrimes[key] = true
+	knownPrimesMutex.Unlock()
+	return true
+}
+
+// checkDHValue checks g_a or g_b: 1 < x < dh_prime-1 with the safety margin
+func checkDHValue(x, dh_prime *big.Int) bool {
+	one := big.NewInt(1)
+	if x.Cmp(one) <= 0 || x.Cmp(new(big.Int).Sub(dh_prime, one)) >= 0 {
+		return false
+	}
+	return x.Cmp(dhSafetyMargin) >= 0 && x.Cmp(new(big.Int).Sub(dh_prime, dhSafetyMargin)) <= 0
+}
+
+// newNonceHash is new_nonce_hash1, 2 or 3 of dh_gen_ok, dh_gen_retry and dh_gen_fail
+func newNonceHash(newNonce []byte, n byte, authKey []byte) []byte {
+	x := make([]byte, 32+1+8)
+	copy(x[0:], newNonce)
+	x[32] = n
+	copy(x[33:], sha1(authKey)[0:8])
+	return sha1(x)[4:20]
+}
+
+// makeGAB makes the secret b read from rnd, g_b to send and the auth key g_ab
+func makeGAB(rnd io.Reader, g int32, g_a, dh_prime *big.Int) (b, g_b, g_ab *big.Int, err error) {
 	rndmax := big.NewInt(0).SetBit(big.NewInt(0), 2048, 1)
-	b = big.NewInt(0).Rand(rnd, rndmax)
-	g_b = big.NewInt(0).Exp(big.NewInt(int64(g)), b, dh_prime)
+	for {
+		b, err = crand.Int(rnd, rndmax)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		g_b = big.NewInt(0).Exp(big.NewInt(int64(g)), b, dh_prime)
+		if checkDHValue(g_b, dh_prime) {
+			break
+		}
+	}
 	g_ab = big.NewInt(0).Exp(g_a, b, dh_prime)
 
 	return
@@ -174,6 +311,105 @@ func generateAES(msg_key, auth_key []byte, decode bool) ([]byte, []byte) {
 	return aes_key, aes_iv
 }
 
+// generateAES2 is the MTProto 2.0 key derivation
+func generateAES2(msg_key, auth_key []byte, decode bool) ([]byte, []byte) {
+	var x int
+	if decode {
+		x = 8
+	}
+	sha256_a := sha256.Sum256(append(append([]byte{}, msg_key...), auth_key[x:x+36]...))
+	sha256_b := sha256.Sum256(append(append([]byte{}, auth_key[40+x:40+x+36]...), msg_key...))
+
+	aes_key := make([]byte, 0, 32)
+	aes_key = append(aes_key, sha256_a[0:8]...)
+	aes_key = append(aes_key, sha256_b[8:24]...)
+	aes_key = append(aes_key, sha256_a[24:32]...)
+
+	aes_iv := make([]byte, 0, 32)
+	aes_iv = append(aes_iv, sha256_b[0:8]...)
+	aes_iv = append(aes_iv, sha256_a[8:24]...)
+	aes_iv = append(aes_iv, sha256_b[24:32]...)
+
+	return aes_key, aes_iv
+}
+
+// messageKey2 is the MTProto 2.0 msg_key, plaintext includes the padding
+func messageKey2(auth_key, plaintext []byte, decode bool) []byte {
+	var x int
+	if decode {
+		x = 8
+	}
+	h := sha256.New()
+	h.Write(auth_key[88+x : 88+x+32])
+	h.Write(plaintext)
+	return h.Sum(nil)[8:24]
+}
+
+// encryptMessage encrypts salt, session_id, msg_id, seq_no, length and the message body
+// decode is set for messages from the server, v1 selects MTProto 1.0, the padding is read from rnd
+func encryptMessage(rnd io.Reader, auth_key, data []byte, decode, v1 bool) (msg_key, encrypted []byte, err error) {
+	var aes_key, aes_iv, y []byte
+	if v1 {
+		msg_key = sha1(data)[4:20]
+		aes_key, aes_iv = generateAES(msg_key, auth_key, decode)
+		y = make([]byte, len(data)+((16-(len(data)%16))&15))
+		copy(y, data)
+	} else {
+		// 12..1024 random bytes, the total length is divisible by 16
+		var n [1]byte
+		if _, err = io.ReadFull(rnd, n[:]); err != nil {
+			return nil, nil, err
+		}
+		padding := 12 + (16-(len(data)+12)%16)%16 + 16*int(n[0]%16)
+		y = make([]byte, len(data)+padding)
+		copy(y, data)
+		if _, err = io.ReadFull(rnd, y[len(data):]); err != nil {
+			return nil, nil, err
+		}
+		msg_key = messageKey2(auth_key, y, decode)
+		aes_key, aes_iv = generateAES2(msg_key, auth_key, decode)
+	}
+	encrypted, err = doAES256IGEencrypt(y, aes_key, aes_iv)
+	return msg_key, encrypted, err
+}
+
+// decryptMessage decrypts the message and checks msg_key and the padding
+// The result is without padding
+func decryptMessage(auth_key, msg_key, encrypted []byte, decode, v1 bool) ([]byte, error) {
+	var aes_key, aes_iv []byte
+	if v1 {
+		aes_key, aes_iv = generateAES(msg_key, auth_key, decode)
+	} else {
+		aes_key, aes_iv = generateAES2(msg_key, auth_key, decode)
+	}
+	x, err := doAES256IGEdecrypt(encrypted, aes_key, aes_iv)
+	if err != nil {
+		return nil, err
+	}
+	if len(x) < 32 {
+		return nil, fmt.Errorf("Message too short: %d", len(x))
+	}
+	messageLen := int(int32(binary.LittleEndian.Uint32(x[28:32])))
+	if messageLen < 0 || messageLen > len(x)-32 {
+		return nil, fmt.Errorf("Message len: %d (need less than %d)", messageLen, len(x)-32)
+	}
+
+	if v1 {
+		if !bytes.Equal(sha1(x[:32+messageLen])[4:20], msg_key) {
+			return nil, errors.New("Wrong msg_key")
+		}
+	} else {
+		if !bytes.Equal(messageKey2(auth_key, x, decode), msg_key) {
+			return nil, errors.New("Wrong msg_key")
+		}
+		padding := len(x) - 32 - messageLen
+		if padding < 12 || padding > 1024 {
+			return nil, fmt.Errorf("Wrong padding length: %d", padding)
+		}
+	}
+	return x[:32+messageLen], nil
+}
+
 func doAES256IGEencrypt(data, key, iv []byte) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -0,0 +1,49 @@
+package mtproto
+
+import (
+	"context"
+	"time"
+)
+
+// FloodWaitHook is called on every FLOOD_WAIT answer
+//
+//	retried is false when wait exceeds the limit and the error is returned to the caller
+type FloodWaitHook func(req TL, wait time.Duration, retried bool)
+
+// FloodWaitMiddleware sleeps on FLOOD_WAIT_X answers up to maxWait and repeats the request
+// Longer waits are returned as *RPCError, see RPCError.FloodWait
+// hook may be nil
+func FloodWaitMiddleware(maxWait time.Duration, hook FloodWaitHook) Middleware {
+	return func(next Invoker) Invoker {
+		return func(ctx context.Context, req TL) (TL, error) {
+			for {
+				x, err := next(ctx, req)
+				rpcErr, ok := AsRPCError(err)
+				if !ok {
+					return x, err
+				}
+				wait, ok := rpcErr.FloodWait()
+				if !ok {
+					return x, err
+				}
+				if wait > maxWait {
+					if hook != nil {
+						hook(req, wait, false)
+					}
+					return x, err
+				}
+				if hook != nil {
+					hook(req, wait, true)
+				}
+
+				t := time.NewTimer(wait)
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					t.Stop()
+					return nil, &TimeoutError{req, ctx.Err()}
+				}
+			}
+		}
+	}
+}
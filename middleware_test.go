@@ -0,0 +1,39 @@
+package mtproto
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFloodWaitMiddleware(t *testing.T) {
+	calls := 0
+	next := func(ctx context.Context, req TL) (TL, error) {
+		calls++
+		switch calls {
+		case 1:
+			return nil, NewRPCError(420, "FLOOD_WAIT_0")
+		case 2:
+			return nil, NewRPCError(420, "FLOOD_WAIT_3600")
+		}
+		return TL_boolTrue{}, nil
+	}
+
+	var waits []time.Duration
+	invoker := FloodWaitMiddleware(time.Minute, func(req TL, wait time.Duration, retried bool) {
+		waits = append(waits, wait)
+	})(next)
+
+	_, err := invoker(context.Background(), TL_help_getConfig{})
+	if e, ok := AsRPCError(err); !ok || e.Argument != 3600 {
+		t.Fatalf("long flood wait: %v, want FLOOD_WAIT_3600", err)
+	}
+	if calls != 2 || len(waits) != 2 || waits[1] != time.Hour {
+		t.Errorf("calls %d, waits %v", calls, waits)
+	}
+
+	x, err := invoker(context.Background(), TL_help_getConfig{})
+	if err != nil || !toBool(x) {
+		t.Errorf("got %v, %v", x, err)
+	}
+}
@@ -1,15 +1,16 @@
 package mtproto
 
 import (
+	"context"
+	"crypto/rsa"
 	"errors"
 	"fmt"
+	"io"
 	"log"
-	"math/rand"
 	"net"
-	"os"
 	"runtime"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -20,6 +21,27 @@ const (
 	DEBUG_LEVEL_DECODE_DETAILS  = 0x08
 )
 
+const dialTimeout = 30 * time.Second
+
+// limits of outgoing containers
+const (
+	maxContainerMessages = 100
+	maxContainerSize     = 32 * 1024
+)
+
+const (
+	// ackFlushInterval is how long acks wait for an outgoing message to go with
+	ackFlushInterval = 500 * time.Millisecond
+	maxAcks          = 1024
+)
+
+// dcOption flags
+const (
+	dcOptionIpv6      = 1 << 0
+	dcOptionMediaOnly = 1 << 1
+	dcOptionCdn       = 1 << 3
+)
+
 var (
 	__debug int32
 )
@@ -28,30 +50,87 @@ type MTProto struct {
 	appId     int64
 	appHash   string
 	addr      string
-	conn      *net.TCPConn
-	f         *os.File
+	conn      net.Conn
+	dialer    ContextDialer
+	proxy     *MTProxy
+	transport Transport
+	storage   SessionStorage
 	queueSend chan packetToSend
 	stopSend  chan struct{}
 	stopRead  chan struct{}
 	stopPing  chan struct{}
-	allDone   chan struct{}
+	routines  sync.WaitGroup
+	running   bool // the routines are started, guarded by reconnectMutex after Connect
 
-	Updates chan TL_updates
+	Updates          chan TL_updates
+	ConnectionEvents chan ConnectionEvent
 
 	authKey     []byte
 	authKeyHash []byte
 	serverSalt  []byte
+	salts       []FutureSalt
+	saltMutex   sync.Mutex
+	saltsUpdate int32 // 1 while get_future_salts is waiting for the answer
 	encrypted   bool
+	mtproto1    bool
 	sessionId   int64
+	dcId        int32
+	apiLayer    int32 // layer of the last successful initConnection, saved in the session
 
 	mutex        *sync.Mutex
 	lastSeqNo    int32
 	msgsIdToAck  map[int64]packetToSend
-	msgsIdToResp map[int64]chan TL
+	msgsIdToResp map[int64]packetToSend
+	containers   map[int64][]int64 // msg_ids of the messages in sent containers
+	stateReqs    map[int64][]int64 // msg_ids asked with msgs_state_req
+	received     receivedMsgs
+	acks         []int64 // incoming messages to acknowledge
+	ackMutex     sync.Mutex
+	seqNoMutex   sync.Mutex
+	sessionMutex sync.Mutex // held while a batch is sent, a new session does not start in the middle of it
 	seqNo        int32
 	msgId        int64
-
-	dclist map[int32]string
+	lastMsgId    int64
+	msgIdMutex   sync.Mutex
+	timeOffset   int64 // server time - local time, ns
+
+	dclist      map[int32]string
+	dcKeys      map[int32][]byte
+	cdnlist     map[int32]string
+	keys        *KeyRing
+	testServers bool
+	random      io.Reader
+
+	pool        map[int32]*MTProto
+	cdnPool     map[int32]*MTProto
+	cdnKeys     map[int32]*rsa.PublicKey
+	poolLocks   map[poolKey]chan struct{}
+	poolMutex   sync.Mutex
+	dcKeysMutex sync.Mutex
+	parent      *MTProto
+	opts        []Option
+
+	newTransport   NewTransport
+	wsEndpoint     func(dc int32) string
+	backoff        Backoff
+	requestTimeout time.Duration
+	middlewares    []Middleware
+	invoker        Invoker
+	connErr        chan error
+	stopSupervise  chan struct{}
+	reconnectMutex sync.Mutex
+	state          int32
+
+	// with PFS messages are encrypted with tempKey bound to authKey
+	tempKeyTTL     time.Duration
+	tempKey        []byte
+	tempKeyHash    []byte
+	tempKeyExpires time.Time
+	tempKeyBound   bool
+
+	// cdn connections send initConnection with the first request
+	cdn         bool
+	initPending int32
 }
 
 type packetToSend struct {
@@ -59,149 +138,259 @@ type packetToSend struct {
 	resp chan TL
 }
 
-func NewMTProto(appId int64, appHash, authkeyfile, dcAddress string, debug int32) (*MTProto, error) {
+func NewMTProto(appId int64, appHash, authkeyfile, dcAddress string, debug int32, opts ...Option) (*MTProto, error) {
+	return NewMTProtoWithStorage(appId, appHash, NewFileSessionStorage(authkeyfile), dcAddress, debug, opts...)
+}
+
+func NewMTProtoWithStorage(appId int64, appHash string, storage SessionStorage, dcAddress string, debug int32, opts ...Option) (*MTProto, error) {
 	var err error
 	m := new(MTProto)
 	__debug = debug
-	if dcAddress == "" {
-		dcAddress = "149.154.167.91:443"
-	}
 
 	m.appId = appId
 	m.appHash = appHash
-
-	m.f, err = os.OpenFile(authkeyfile, os.O_RDWR|os.O_CREATE, 0600)
-	if err != nil {
-		return nil, err
+	m.storage = storage
+	m.dialer = &net.Dialer{}
+	m.newTransport = NewAbridgedTransport
+	m.backoff = DefaultBackoff
+	m.requestTimeout = DefaultRequestTimeout
+	m.ConnectionEvents = make(chan ConnectionEvent, 16)
+	m.opts = opts
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.buildInvoker()
+	if dcAddress == "" {
+		dcAddress = productionDCAddress
+		if m.testServers {
+			dcAddress = testDCAddress
+		}
+	}
+	if m.keys == nil {
+		m.keys = ProductionKeys()
+		if m.testServers {
+			m.keys = TestKeys()
+		}
 	}
 
 	err = m.readData()
-	if err == nil {
+	switch err {
+	case nil:
 		m.encrypted = true
-	} else {
+	case ErrSessionNotFound:
 		m.addr = dcAddress
 		m.encrypted = false
+	default:
+		return nil, err
+	}
+	m.sessionId, err = m.randomInt64()
+	if err != nil {
+		return nil, err
 	}
-	rand.Seed(time.Now().UnixNano())
-	m.sessionId = rand.Int63()
 
 	return m, nil
 }
 
 func (m *MTProto) Connect() error {
 	var err error
-	var tcpAddr *net.TCPAddr
-	// connect
-	if strings.Count(m.addr, ":") <= 1 {
-		tcpAddr, err = net.ResolveTCPAddr("tcp", m.addr)
-		if err != nil {
-			log.Println("IPv4::", err.Error())
-			return err
-		}
-		m.conn, err = net.DialTCP("tcp", nil, tcpAddr)
+
+	m.setState(CONNECTION_STATE_CONNECTING, nil)
+	err = m.dial()
+	if err != nil {
+		m.setState(CONNECTION_STATE_DISCONNECTED, err)
+		return err
+	}
+
+	// start goroutines
+	m.Updates = make(chan TL_updates, 1024)
+
+	m.queueSend = make(chan packetToSend, 64)
+	m.stopPing = make(chan struct{})
+	m.stopSupervise = make(chan struct{})
+	m.connErr = make(chan error, 1)
+	m.msgsIdToAck = make(map[int64]packetToSend)
+	m.msgsIdToResp = make(map[int64]packetToSend)
+	m.mutex = &sync.Mutex{}
+	bound, err := m.bindTempKey()
+	if err != nil {
+		m.conn.Close()
+		m.setState(CONNECTION_STATE_DISCONNECTED, err)
+		return err
+	}
+	m.startRoutines()
+	err = m.waitTempKeyBound(bound)
+	if err != nil {
+		m.stopRoutines()
+		m.setState(CONNECTION_STATE_DISCONNECTED, err)
+		return err
+	}
+
+	if m.cdn {
+		// CDN DCs do not answer help.getConfig
+		atomic.StoreInt32(&m.initPending, 1)
 	} else {
-		idx := strings.LastIndex(m.addr, ":")
-		m.addr = fmt.Sprintf("%s:%s", m.addr[:idx], m.addr[idx+1:])
-		tcpAddr, err = net.ResolveTCPAddr("tcp6", m.addr)
+		err = m.initConnection()
 		if err != nil {
-			log.Println("IPv6::", err.Error())
+			m.stopRoutines()
+			m.setState(CONNECTION_STATE_DISCONNECTED, err)
 			return err
 		}
+	}
+	m.setState(CONNECTION_STATE_CONNECTED, nil)
+
+	// start keepalive pinging and reconnecting
+	go m.pingRoutine()
+	go m.superviseRoutine()
 
-		m.conn, err = net.DialTCP("tcp6", nil, tcpAddr)
+	return nil
+}
+
+// dial opens the tcp connection and makes a new auth key if needed
+// With PFS it also makes a new temporary key when the current one expires, see bindTempKey
+func (m *MTProto) dial() error {
+	var err error
+	addr, newTransport := dialAddr(m.addr), m.newTransport
+	if m.proxy != nil {
+		addr, newTransport = m.proxy.addr, m.proxy.transport(m.addrDC())
+	}
+
+	// connect
+	ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+	defer cancel()
+	if m.wsEndpoint != nil {
+		m.conn, err = dialWebSocket(ctx, m.dialer, m.wsEndpoint(m.addrDC()), m.randomSource())
+		newTransport = NewObfuscatedTransport(m.newTransport)
+	} else {
+		m.conn, err = m.dialer.DialContext(ctx, "tcp", addr)
 	}
 	if err != nil {
 		return err
 	}
-	_, err = m.conn.Write([]byte{0xef})
+	m.transport = newTransport(m.randomSource())
+	err = m.transport.Init(m.conn)
 	if err != nil {
+		m.conn.Close()
 		return err
 	}
 
 	// get new authKey if need
 	if !m.encrypted {
-		err = m.makeAuthKey()
+		authKey, serverSalt, err := m.makeAuthKey(0)
 		if err != nil {
+			m.conn.Close()
+			return err
+		}
+		m.useAuthKey(authKey)
+		m.resetSalts(serverSalt)
+		err = m.saveData()
+		if err != nil {
+			m.conn.Close()
 			return err
 		}
 	}
+	if m.tempKeyExpiring() {
+		err = m.makeTempKey()
+		if err != nil {
+			m.conn.Close()
+			return err
+		}
+	}
+	return nil
+}
 
-	// start goroutines
-	m.Updates = make(chan TL_updates, 1024)
-
-	m.queueSend = make(chan packetToSend, 64)
-	m.stopSend = make(chan struct{}, 1)
-	m.stopRead = make(chan struct{}, 1)
-	m.stopPing = make(chan struct{}, 1)
-	m.allDone = make(chan struct{}, 3)
-	m.msgsIdToAck = make(map[int64]packetToSend)
-	m.msgsIdToResp = make(map[int64]chan TL)
-	m.mutex = &sync.Mutex{}
-	go m.sendRoutine()
-	go m.readRoutine()
-
-	var resp chan TL
-	var x TL
-
-	resp = make(chan TL, 1)
-	m.queueSend <- packetToSend{
-		TL_invokeWithLayer{
-			layer,
-			TL_initConnection{
-				int32(m.appId),
-				"NESTED",
-				runtime.GOOS + "/" + runtime.GOARCH,
-				"1.0.0",
-				"en",
-				"",
-				"en",
-				TL_help_getConfig{},
-			},
+// initConnectionRequest wraps query with invokeWithLayer and initConnection
+func (m *MTProto) initConnectionRequest(query TL) TL {
+	return TL_invokeWithLayer{
+		layer,
+		TL_initConnection{
+			int32(m.appId),
+			"NESTED",
+			runtime.GOOS + "/" + runtime.GOARCH,
+			"1.0.0",
+			"en",
+			"",
+			"en",
+			query,
 		},
-		resp,
 	}
-	x = <-resp
+}
+
+// initConnection sends help.getConfig wrapped in initConnection and keeps the DC list
+// It bypasses the middlewares: invoke migrates, and migrate itself calls initConnection
+func (m *MTProto) initConnection() error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultRequestTimeout)
+	defer cancel()
+	x, err := m.send(ctx, m.initConnectionRequest(TL_help_getConfig{}))
+	if err != nil {
+		return err
+	}
 	switch x.(type) {
 	case TL_config:
-		m.dclist = make(map[int32]string, 5)
+		m.apiLayer = layer
+		m.dcId = x.(TL_config).This_dc
+		dclist := make(map[int32]string, 5)
+		cdnlist := make(map[int32]string)
 		for _, v := range x.(TL_config).Dc_options {
 			v := v.(TL_dcOption)
-			m.dclist[v.Id] = fmt.Sprintf("%s:%d", v.Ip_address, v.Port)
+			addr := fmt.Sprintf("%s:%d", v.Ip_address, v.Port)
+			if v.Flags&dcOptionCdn != 0 {
+				cdnlist[v.Id] = addr
+				continue
+			}
+			if _, ok := dclist[v.Id]; ok && v.Flags&(dcOptionIpv6|dcOptionMediaOnly) != 0 {
+				// keep the first plain IPv4 address
+				continue
+			}
+			dclist[v.Id] = addr
 		}
+		// the pool connections read the lists from their goroutines, see dcList
+		m.mutex.Lock()
+		m.dclist, m.cdnlist = dclist, cdnlist
+		m.mutex.Unlock()
+		return m.saveData()
 	default:
 		return fmt.Errorf("Got: %T, %#v", x, x)
 	}
+}
 
-	// start keepalive pinging
-	go m.pingRoutine()
+// startRoutines starts send and read routines for the current connection
+func (m *MTProto) startRoutines() {
+	m.stopSend = make(chan struct{})
+	m.stopRead = make(chan struct{})
+	m.running = true
+	m.routines.Add(2)
+	go m.sendRoutine(m.stopSend)
+	go m.readRoutine(m.stopRead)
+}
 
-	return nil
+// stopRoutines closes the current connection and waits for its routines
+// It does nothing if they are already stopped, e.g. by a failed migrate
+func (m *MTProto) stopRoutines() error {
+	if !m.running {
+		return nil
+	}
+	m.running = false
+	close(m.stopSend)
+	close(m.stopRead)
+	err := m.conn.Close()
+	m.routines.Wait()
+	return err
 }
 
 func (m *MTProto) Disconnect() error {
-	var err error
+	m.closePool()
 
-	// stop ping routine
-	m.stopPing <- struct{}{}
+	// stop ping and reconnecting
 	close(m.stopPing)
+	close(m.stopSupervise)
 
-	// stop send routine
-	m.stopSend <- struct{}{}
-	close(m.stopSend)
-
-	// stop read routine
-	m.stopRead <- struct{}{}
-	close(m.stopRead)
+	m.reconnectMutex.Lock()
+	defer m.reconnectMutex.Unlock()
 
-	// close send queue
-	close(m.queueSend)
+	// stop send and read routines, close connection
+	err := m.stopRoutines()
 	close(m.Updates)
-
-	<-m.allDone
-	<-m.allDone
-
-	// close connection
-	err = m.conn.Close()
+	m.setState(CONNECTION_STATE_DISCONNECTED, nil)
 	if err != nil {
 		return err
 	}
@@ -209,79 +398,217 @@ func (m *MTProto) Disconnect() error {
 }
 
 func (m *MTProto) GetDcAddress(dcID int32) string {
-	return m.dclist[dcID]
+	return m.dcList()[dcID]
 }
 
-func (m *MTProto) reconnect(newaddr string) error {
-	var err error
+// dcList returns the DC addresses, initConnection replaces the map and never changes it afterwards
+func (m *MTProto) dcList() map[int32]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.dclist
+}
 
-	// stop ping routine
-	m.stopPing <- struct{}{}
-	close(m.stopPing)
+// cdnList returns the CDN DC addresses, see dcList
+func (m *MTProto) cdnList() map[int32]string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.cdnlist
+}
 
-	// stop send routine
-	m.stopSend <- struct{}{}
-	close(m.stopSend)
+// migrate moves the connection to another home DC
+// The auth key of the old DC is kept in dcKeys and reused when migrating back
+// The key of the new DC stays in dcKeys as well, a pool connection to the DC may still use it
+func (m *MTProto) migrate(dc int32) error {
+	var err error
 
-	// stop read routine
-	m.stopRead <- struct{}{}
-	close(m.stopRead)
+	m.reconnectMutex.Lock()
+	defer m.reconnectMutex.Unlock()
 
-	// close send queue
-	close(m.queueSend)
-	close(m.Updates)
+	if dc == m.dcId {
+		// already migrated by a concurrent request
+		return nil
+	}
+	newaddr, ok := m.dcList()[dc]
+	if !ok {
+		return fmt.Errorf("Wrong DC index: %d", dc)
+	}
 
-	<-m.allDone
-	<-m.allDone
+	_ = m.stopRoutines()
 
-	// close connection
-	err = m.conn.Close()
+	// renew connection
+	m.setState(CONNECTION_STATE_CONNECTING, nil)
+	if m.dcId != 0 && m.encrypted {
+		m.setDcKey(m.dcId, m.authKey)
+	}
+	m.useAuthKey(m.dcKey(dc))
+	m.addr = newaddr
+	err = m.dial()
+	if err != nil {
+		m.setState(CONNECTION_STATE_DISCONNECTED, err)
+		m.connFailed(err)
+		return err
+	}
+	bound, err := m.bindTempKey()
 	if err != nil {
+		m.conn.Close()
+		m.setState(CONNECTION_STATE_DISCONNECTED, err)
+		m.connFailed(err)
 		return err
 	}
+	m.startRoutines()
+	err = m.waitTempKeyBound(bound)
+	if err != nil {
+		m.connFailed(err)
+		return err
+	}
+	err = m.initConnection()
+	if err != nil {
+		_ = m.stopRoutines()
+		m.setState(CONNECTION_STATE_DISCONNECTED, err)
+		m.connFailed(err)
+		return err
+	}
+	err = m.saveData()
+	if err != nil {
+		return err
+	}
+	m.resendInflight()
+	m.setState(CONNECTION_STATE_CONNECTED, nil)
+	return nil
+}
 
-	// renew connection
-	m.encrypted = false
-	m.addr = newaddr
-	err = m.Connect()
-	return err
+// addrDC returns the id of the DC at m.addr, the home DC is the default
+// New sessions start on DC 2
+func (m *MTProto) addrDC() int32 {
+	for id, addr := range m.dcList() {
+		if addr == m.addr {
+			return id
+		}
+	}
+	if m.dcId != 0 {
+		return m.dcId
+	}
+	return 2
+}
+
+// useAuthKey switches to the given auth key, nil means a new key will be made on dial
+func (m *MTProto) useAuthKey(key []byte) {
+	// a temporary key and the future salts belong to the DC of the key
+	m.dropTempKey()
+	m.resetSalts(m.serverSalt)
+	if key == nil {
+		m.authKey = nil
+		m.authKeyHash = nil
+		m.encrypted = false
+		return
+	}
+	m.authKey = key
+	m.authKeyHash = sha1(key)[12:20]
+	m.encrypted = true
 }
 
 func (m *MTProto) pingRoutine() {
 	for {
 		select {
 		case <-m.stopPing:
-			m.allDone <- struct{}{}
 			return
 		case <-time.After(30 * time.Second):
-			//resp := make(chan TL, 1)
-			m.queueSend <- packetToSend{TL_ping{0xCADACADA}, nil}
-			//x := <-resp
-			//fmt.Println("PingReply::", reflect.TypeOf(x).String(), x)
+			select {
+			case m.queueSend <- packetToSend{TL_ping{0xCADACADA}, nil}:
+			case <-m.stopPing:
+				return
+			}
+			if ids := m.staleMessages(); len(ids) > 0 {
+				select {
+				case m.queueSend <- packetToSend{TL_msgs_state_req{ids}, nil}:
+				case <-m.stopPing:
+					return
+				}
+			}
+			m.checkFutureSalts()
 		}
 	}
 }
 
-func (m *MTProto) sendRoutine() {
-	for x := range m.queueSend {
-		err := m.sendPacket(x.msg, x.resp)
+// sendRoutine sends the queued messages, pending acks go with them or every ackFlushInterval
+func (m *MTProto) sendRoutine(stop <-chan struct{}) {
+	defer m.routines.Done()
+	flush := time.NewTicker(ackFlushInterval)
+	defer flush.Stop()
+	for {
+		var batch []packetToSend
+		select {
+		case <-stop:
+			return
+		case x := <-m.queueSend:
+			batch = m.drainQueue(x)
+		case <-flush.C:
+		}
+		if acks := m.pendingAcks(); len(acks) > 0 {
+			batch = append(batch, packetToSend{TL_msgs_ack{acks}, nil})
+		}
+		err := m.sendPackets(batch)
 		if err != nil {
-			fmt.Println("SendRoutine:", err)
-			os.Exit(2)
+			log.Println("SendRoutine:", err)
+			m.connFailed(err)
+			return
+		}
+	}
+}
+
+// ack buffers the acknowledgment of an incoming message for the send routine
+func (m *MTProto) ack(msgId int64) {
+	m.ackMutex.Lock()
+	m.acks = append(m.acks, msgId)
+	m.ackMutex.Unlock()
+}
+
+// pendingAcks returns up to maxAcks buffered acknowledgments
+func (m *MTProto) pendingAcks() []int64 {
+	m.ackMutex.Lock()
+	defer m.ackMutex.Unlock()
+	n := len(m.acks)
+	if n > maxAcks {
+		n = maxAcks
+	}
+	acks := append([]int64(nil), m.acks[:n]...)
+	m.acks = m.acks[n:]
+	return acks
+}
+
+// drainQueue returns x with the packets waiting in the send queue, up to maxContainerMessages
+func (m *MTProto) drainQueue(x packetToSend) []packetToSend {
+	batch := []packetToSend{x}
+	for len(batch) < maxContainerMessages {
+		select {
+		case x = <-m.queueSend:
+			batch = append(batch, x)
+		default:
+			return batch
 		}
 	}
-	m.allDone <- struct{}{}
+	return batch
 }
 
-func (m *MTProto) readRoutine() {
+func (m *MTProto) readRoutine(stop <-chan struct{}) {
+	defer m.routines.Done()
 	for {
-		data, err := m.read(m.stopRead)
+		data, err := m.read(stop)
+		if err == errWrongSession {
+			log.Println("ReadRoutine:", err)
+			continue
+		}
 		if err != nil {
-			fmt.Println("ReadRoutine:", err)
-			os.Exit(2)
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			log.Println("ReadRoutine:", err)
+			m.connFailed(err)
+			return
 		}
 		if data == nil {
-			m.allDone <- struct{}{}
 			return
 		}
 		m.process(m.msgId, m.seqNo, data)
@@ -289,7 +616,19 @@ func (m *MTProto) readRoutine() {
 
 }
 
+// enqueue puts a service packet to the send queue, it gives up when the read routine stops
+func (m *MTProto) enqueue(x packetToSend) {
+	select {
+	case m.queueSend <- x:
+	case <-m.stopRead:
+	}
+}
+
 func (m *MTProto) process(msgId int64, seqNo int32, data interface{}) interface{} {
+	m.received.add(msgId, seqNo)
+	if seqNo&1 == 1 {
+		m.ack(msgId)
+	}
 	switch data.(type) {
 	case TL_msg_container:
 		data := data.(TL_msg_container).items
@@ -299,23 +638,62 @@ func (m *MTProto) process(msgId int64, seqNo int32, data interface{}) interface{
 
 	case TL_bad_server_salt:
 		data := data.(TL_bad_server_salt)
-		m.serverSalt = data.new_server_salt
+		// the future salts are wrong too, checkFutureSalts asks for new ones
+		m.resetSalts(data.new_server_salt)
 		_ = m.saveData()
-		m.mutex.Lock()
-		for k, v := range m.msgsIdToAck {
-			delete(m.msgsIdToAck, k)
-			m.queueSend <- v
+		m.resend(data.bad_msg_id)
+
+	case TL_crc_bad_msg_notification:
+		m.badMsgNotification(msgId, data.(TL_crc_bad_msg_notification))
+
+	case TL_msgs_state_req:
+		m.answerStateReq(msgId, data.(TL_msgs_state_req))
+
+	case TL_msgs_state_info:
+		m.stateInfo(data.(TL_msgs_state_info))
+
+	case TL_msgs_all_info:
+		data := data.(TL_msgs_all_info)
+		m.applyMsgsState(data.msg_ids, data.info)
+
+	case TL_msg_resend_req:
+		for _, id := range data.(TL_msg_resend_req).msg_ids {
+			m.resend(id)
 		}
+
+	case TL_msg_detailed_info:
+		data := data.(TL_msg_detailed_info)
+		m.mutex.Lock()
+		delete(m.msgsIdToAck, data.msg_id)
 		m.mutex.Unlock()
+		m.detailedInfo(data.answer_msg_id)
+
+	case TL_msg_new_detailed_info:
+		m.detailedInfo(data.(TL_msg_new_detailed_info).answer_msg_id)
+
+	case TL_future_salts:
+		m.futureSaltsResult(data.(TL_future_salts))
+		return data
+
+	case TL_destroy_session_ok:
+		m.destroySessionResult(data.(TL_destroy_session_ok).session_id, data.(TL))
+		return data
+
+	case TL_destroy_session_none:
+		m.destroySessionResult(data.(TL_destroy_session_none).session_id, data.(TL))
+		return data
 
 	case TL_new_session_created:
 		data := data.(TL_new_session_created)
-		m.serverSalt = data.server_salt
+		if m.setServerTime(msgId) {
+			m.resendUnacked()
+		}
+		m.setSalt(data.server_salt)
 		_ = m.saveData()
 
 	case TL_ping:
 		data := data.(TL_ping)
-		m.queueSend <- packetToSend{TL_pong{msgId, data.ping_id}, nil}
+		m.enqueue(packetToSend{TL_pong{msgId, data.ping_id}, nil})
 
 	case TL_pong:
 		// (ignore)
@@ -330,12 +708,13 @@ func (m *MTProto) process(msgId int64, seqNo int32, data interface{}) interface{
 
 	case TL_rpc_result:
 		data := data.(TL_rpc_result)
-		x := m.process(msgId, seqNo, data.obj)
+		// the message is acknowledged already
+		x := m.process(msgId, seqNo&^1, data.obj)
 		m.mutex.Lock()
 		v, ok := m.msgsIdToResp[data.req_msg_id]
 		if ok {
-			v <- x.(TL)
-			close(v)
+			v.resp <- x.(TL)
+			close(v.resp)
 			delete(m.msgsIdToResp, data.req_msg_id)
 		}
 		delete(m.msgsIdToAck, data.req_msg_id)
@@ -349,51 +728,88 @@ func (m *MTProto) process(msgId int64, seqNo int32, data interface{}) interface{
 
 	}
 
-	if (seqNo & 1) == 1 {
-		m.queueSend <- packetToSend{TL_msgs_ack{[]int64{msgId}}, nil}
-	}
-
 	return nil
 }
 
+// resend puts a message waiting for an ack back to the send queue, it gets a new msg_id
+// msgId may be a container, then its messages are resent; 0 resends every waiting message
+func (m *MTProto) resend(msgId int64) {
+	m.mutex.Lock()
+	var ids []int64
+	if msgId == 0 {
+		for k := range m.msgsIdToAck {
+			ids = append(ids, k)
+		}
+	} else if items, ok := m.containers[msgId]; ok {
+		ids = items
+		delete(m.containers, msgId)
+	} else {
+		ids = []int64{msgId}
+	}
+	resend := make([]packetToSend, 0, len(ids))
+	for _, k := range ids {
+		if v, ok := m.msgsIdToAck[k]; ok {
+			delete(m.msgsIdToAck, k)
+			delete(m.msgsIdToResp, k)
+			resend = append(resend, v)
+		}
+	}
+	m.mutex.Unlock()
+	for _, v := range resend {
+		m.enqueue(v)
+	}
+}
+
 func (m *MTProto) saveData() (err error) {
 	m.encrypted = true
 
-	b := NewEncodeBuf(1024)
-	b.StringBytes(m.authKey)
-	b.StringBytes(m.authKeyHash)
-	b.StringBytes(m.serverSalt)
-	b.String(m.addr)
+	m.saltMutex.Lock()
+	serverSalt, salts := m.serverSalt, append([]FutureSalt(nil), m.salts...)
+	m.saltMutex.Unlock()
+	return m.storage.Save(&Session{
+		AuthKey:     m.authKey,
+		AuthKeyHash: m.authKeyHash,
+		ServerSalt:  serverSalt,
+		Salts:       salts,
+		Addr:        m.addr,
+		DcID:        m.dcId,
+		Layer:       m.apiLayer,
+		DcList:      m.dcList(),
+		DcKeys:      m.copyDcKeys(),
+		TestServers: m.testServers,
+	})
+}
 
-	err = m.f.Truncate(0)
+func (m *MTProto) readData() (err error) {
+	s, err := m.storage.Load()
 	if err != nil {
 		return err
 	}
+	if s.TestServers != m.testServers {
+		if s.TestServers {
+			return errors.New("Session: saved with the test servers")
+		}
+		return errors.New("Session: saved with the production servers")
+	}
 
-	_, err = m.f.WriteAt(b.buf, 0)
-	if err != nil {
-		return err
+	m.authKey = s.AuthKey
+	m.authKeyHash = s.AuthKeyHash
+	m.serverSalt = s.ServerSalt
+	m.salts = s.Salts
+	m.addr = s.Addr
+	m.dcId = s.DcID
+	m.apiLayer = s.Layer
+	if len(s.DcList) > 0 {
+		m.dclist = s.DcList
 	}
+	m.dcKeys = s.DcKeys
 
 	return nil
 }
 
-func (m *MTProto) readData() (err error) {
-	b := make([]byte, 1024*4)
-	n, err := m.f.ReadAt(b, 0)
-	if n <= 0 {
-		return errors.New("New session")
-	}
-
-	d := NewDecodeBuf(b)
-	m.authKey = d.StringBytes()
-	m.authKeyHash = d.StringBytes()
-	m.serverSalt = d.StringBytes()
-	m.addr = d.String()
-
-	if d.err != nil {
-		return d.err
-	}
-
-	return nil
+// DeleteSession removes the stored session, the next Connect will generate a new auth key
+func (m *MTProto) DeleteSession() error {
+	m.encrypted = false
+	m.dropTempKey()
+	return m.storage.Delete()
 }
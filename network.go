@@ -12,93 +12,217 @@ import (
 )
 
 func (m *MTProto) sendPacket(msg TL, resp chan TL) error {
-	obj := msg.encode()
-	if __debug&DEBUG_LEVEL_NETWORK != 0 {
-		log.Println("MTProto::sendPacket::", reflect.TypeOf(msg).String())
+	if !m.encrypted {
+		return m.sendPlain(msg)
 	}
-	if __debug&DEBUG_LEVEL_NETWORK_DETAILS != 0 {
-		fmt.Println(hex.Dump(msg.encode()))
-	}
-	x := NewEncodeBuf(256)
-
-	// padding for tcpsize
-	x.Int(0)
-
-	if m.encrypted {
-		needAck := true
-		switch msg.(type) {
-		case TL_ping, TL_msgs_ack:
-			needAck = false
-		}
-		z := NewEncodeBuf(256)
-		newMsgId := GenerateMessageId()
-		z.Bytes(m.serverSalt)
-		z.Long(m.sessionId)
-		z.Long(newMsgId)
-		if needAck {
-			z.Int(m.lastSeqNo | 1)
-		} else {
-			z.Int(m.lastSeqNo)
-		}
-		z.Int(int32(len(obj)))
-		z.Bytes(obj)
-
-		msgKey := sha1(z.buf)[4:20]
-		aesKey, aesIV := generateAES(msgKey, m.authKey, false)
+	return m.sendPackets([]packetToSend{{msg, resp}})
+}
 
-		y := make([]byte, len(z.buf)+((16-(len(obj)%16))&15))
-		copy(y, z.buf)
-		encryptedData, err := doAES256IGEencrypt(y, aesKey, aesIV)
+// sendPackets sends the messages in containers of up to maxContainerSize bytes,
+// a single message or a message too big for a container is sent alone
+func (m *MTProto) sendPackets(batch []packetToSend) error {
+	m.sessionMutex.Lock()
+	defer m.sessionMutex.Unlock()
+	var items []TL_MT_message
+	size := 0
+	for _, x := range batch {
+		item, err := m.newMessage(x.msg, x.resp)
 		if err != nil {
 			return err
 		}
-
-		m.lastSeqNo += 2
-		if needAck {
-			m.mutex.Lock()
-			m.msgsIdToAck[newMsgId] = packetToSend{msg, resp}
-			m.mutex.Unlock()
+		body := item.data.([]byte)
+		if len(items) > 0 && size+16+len(body) > maxContainerSize {
+			err = m.sendContainer(items)
+			if err != nil {
+				return err
+			}
+			items, size = nil, 0
 		}
+		items = append(items, item)
+		size += 16 + len(body)
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	return m.sendContainer(items)
+}
 
-		x.Bytes(m.authKeyHash)
-		x.Bytes(msgKey)
-		x.Bytes(encryptedData)
+func (m *MTProto) sendContainer(items []TL_MT_message) error {
+	if len(items) == 1 {
+		return m.writeMessage(items[0])
+	}
+	// the container is not content related and gets the greatest msg_id
+	container := TL_MT_message{
+		msg_id: m.newMsgId(),
+		seq_no: m.nextSeqNo(false),
+		data:   TL_msg_container{items}.encode(),
+	}
+	m.trackContainer(container.msg_id, items)
+	return m.writeMessage(container)
+}
 
-		if resp != nil {
-			m.mutex.Lock()
-			m.msgsIdToResp[newMsgId] = resp
-			m.mutex.Unlock()
+// trackContainer remembers the messages of a container, a bad_msg_notification may refer to the container
+// Containers with all messages acknowledged are forgotten
+func (m *MTProto) trackContainer(msgId int64, items []TL_MT_message) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.containers == nil {
+		m.containers = make(map[int64][]int64)
+	}
+	for k, ids := range m.containers {
+		acked := true
+		for _, id := range ids {
+			if _, ok := m.msgsIdToAck[id]; ok {
+				acked = false
+				break
+			}
 		}
+		if acked {
+			delete(m.containers, k)
+		}
+	}
+	ids := make([]int64, len(items))
+	for i, v := range items {
+		ids[i] = v.msg_id
+	}
+	m.containers[msgId] = ids
+}
 
-	} else {
-		x.Long(0)
-		x.Long(GenerateMessageId())
-		x.Int(int32(len(obj)))
-		x.Bytes(obj)
+// newMessage encodes msg with a new msg_id and seq_no and tracks it for acks and the response
+func (m *MTProto) newMessage(msg TL, resp chan TL) (TL_MT_message, error) {
+	obj := msg.encode()
+	debugSend(msg)
+
+	// requests are content related, service messages about messages are not
+	content := true
+	switch msg.(type) {
+	case TL_msgs_ack, TL_pong, TL_msgs_state_req, TL_msgs_state_info, TL_msg_resend_req:
+		content = false
+	}
+	// lost pings are not resent
+	needAck := content
+	if _, ok := msg.(TL_ping); ok {
+		needAck = false
+	}
+	newMsgId := m.newMsgId()
+	if b, ok := msg.(tempKeyBinding); ok {
+		req, err := b.request(newMsgId)
+		if err != nil {
+			return TL_MT_message{}, err
+		}
+		obj = req.encode()
+	}
+	if content && len(obj) >= gzipThreshold {
+		switch msg.(type) {
+		case TL_upload_saveFilePart, TL_upload_saveBigFilePart:
+			// file parts are usually compressed already
+		default:
+			obj = gzipPacked(obj)
+		}
+	}
+	seqNo := m.nextSeqNo(content)
+	if req, ok := msg.(TL_msgs_state_req); ok {
+		m.trackStateReq(newMsgId, req.msg_ids)
+	}
 
+	if needAck {
+		m.mutex.Lock()
+		m.msgsIdToAck[newMsgId] = packetToSend{msg, resp}
+		m.mutex.Unlock()
+	}
+	if resp != nil {
+		m.mutex.Lock()
+		m.msgsIdToResp[newMsgId] = packetToSend{msg, resp}
+		m.mutex.Unlock()
 	}
+	return TL_MT_message{msg_id: newMsgId, seq_no: seqNo, size: int32(len(obj)), data: obj}, nil
+}
 
-	// minus padding
-	size := len(x.buf)/4 - 1
+// nextSeqNo returns the seq_no of a new message:
+// twice the number of content related messages sent before, plus one for a content related message
+func (m *MTProto) nextSeqNo(content bool) int32 {
+	m.seqNoMutex.Lock()
+	defer m.seqNoMutex.Unlock()
+	seqNo := m.lastSeqNo
+	if content {
+		seqNo |= 1
+		m.lastSeqNo += 2
+	}
+	return seqNo
+}
 
-	if size < 127 {
-		x.buf[3] = byte(size)
-		x.buf = x.buf[3:]
-	} else {
-		binary.LittleEndian.PutUint32(x.buf, uint32(size<<8|127))
+// newSession starts a new session with a new session_id, seq_no and msg_id are counted from zero again
+// The server tells with bad_msg_notification 32 and 33 that our seq_no is wrong, the docs recommend a new session then,
+// setServerTime starts one when msg_id has to go back
+// https://core.telegram.org/mtproto/service_messages_about_messages#notice-of-ignored-error-message
+func (m *MTProto) newSession() error {
+	sessionId, err := m.randomInt64()
+	if err != nil {
+		return err
 	}
-	_, err := m.conn.Write(x.buf)
+	m.sessionMutex.Lock()
+	defer m.sessionMutex.Unlock()
+	m.seqNoMutex.Lock()
+	defer m.seqNoMutex.Unlock()
+	m.msgIdMutex.Lock()
+	defer m.msgIdMutex.Unlock()
+	m.sessionId = sessionId
+	m.lastSeqNo = 0
+	// msg_ids grow within a session only, the new one starts from the server time
+	m.lastMsgId = 0
+	return nil
+}
+
+// writeMessage encrypts an encoded message and writes it to the connection
+func (m *MTProto) writeMessage(item TL_MT_message) error {
+	obj := item.data.([]byte)
+	z := NewEncodeBuf(32 + len(obj))
+	z.Bytes(m.salt())
+	z.Long(m.sessionId)
+	z.Long(item.msg_id)
+	z.Int(item.seq_no)
+	z.Int(int32(len(obj)))
+	z.Bytes(obj)
+
+	key, keyHash := m.sessionKey()
+	msgKey, encryptedData, err := encryptMessage(m.randomSource(), key, z.buf, false, m.mtproto1)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	x := NewEncodeBuf(24 + len(encryptedData))
+	x.Bytes(keyHash)
+	x.Bytes(msgKey)
+	x.Bytes(encryptedData)
+	return m.transport.WritePacket(m.conn, x.buf)
+}
+
+// sendPlain sends an unencrypted message of the auth key handshake
+func (m *MTProto) sendPlain(msg TL) error {
+	obj := msg.encode()
+	debugSend(msg)
+	x := NewEncodeBuf(256)
+	x.Long(0)
+	x.Long(m.newMsgId())
+	x.Int(int32(len(obj)))
+	x.Bytes(obj)
+	return m.transport.WritePacket(m.conn, x.buf)
 }
 
+func debugSend(msg TL) {
+	if __debug&DEBUG_LEVEL_NETWORK != 0 {
+		log.Println("MTProto::sendPacket::", reflect.TypeOf(msg).String())
+	}
+	if __debug&DEBUG_LEVEL_NETWORK_DETAILS != 0 {
+		fmt.Println(hex.Dump(msg.encode()))
+	}
+}
+
+// errWrongSession is returned by read for a message with a session_id other than ours
+var errWrongSession = errors.New("Wrong session_id")
+
 func (m *MTProto) read(stop <-chan struct{}) (interface{}, error) {
 	var err error
-	var n int
-	var size int
 	var data interface{}
 
 	err = m.conn.SetReadDeadline(time.Now().Add(300 * time.Second))
@@ -106,8 +230,7 @@ func (m *MTProto) read(stop <-chan struct{}) (interface{}, error) {
 		log.Println("ReadDeadLine")
 		return nil, err
 	}
-	b := make([]byte, 1)
-	n, err = m.conn.Read(b)
+	buf, err := m.transport.ReadPacket(m.conn)
 	if stop != nil {
 		select {
 		case <-stop:
@@ -116,36 +239,16 @@ func (m *MTProto) read(stop <-chan struct{}) (interface{}, error) {
 		}
 	}
 	if err != nil {
-		log.Println("read 1st byte")
-		log.Printf("%#v", err)
 		return nil, err
 	}
-	if b[0] < 127 {
-		size = int(b[0]) << 2
-	} else {
-		b := make([]byte, 3)
-		n, err = m.conn.Read(b)
-		if err != nil {
-			log.Println("read 3-bytes byte")
-			return nil, err
-		}
-		size = (int(b[0]) | int(b[1])<<8 | int(b[2])<<16) << 2
-	}
-
-	left := size
-	buf := make([]byte, size)
-	for left > 0 {
-		n, err = m.conn.Read(buf[size-left:])
-		if err != nil {
-			log.Println("reading error:", size, left)
-			return nil, err
-		}
-		left -= n
-	}
+	size := len(buf)
 
 	if size == 4 {
 		return nil, fmt.Errorf("Server response error: %d", int32(binary.LittleEndian.Uint32(buf)))
 	}
+	if size < 8 {
+		return nil, fmt.Errorf("Packet too short: %d", size)
+	}
 
 	dbuf := NewDecodeBuf(buf)
 
@@ -153,7 +256,8 @@ func (m *MTProto) read(stop <-chan struct{}) (interface{}, error) {
 	if binary.LittleEndian.Uint64(authKeyHash) == 0 {
 		m.msgId = dbuf.Long()
 		messageLen := dbuf.Int()
-		if int(messageLen) != dbuf.size-20 {
+		// padded intermediate transport may add up to 15 bytes
+		if int(messageLen) > dbuf.size-20 || int(messageLen) < dbuf.size-20-15 {
 			return nil, fmt.Errorf("Message len: %d (need %d)", messageLen, dbuf.size-20)
 		}
 		m.seqNo = 0
@@ -165,24 +269,22 @@ func (m *MTProto) read(stop <-chan struct{}) (interface{}, error) {
 
 	} else {
 		msgKey := dbuf.Bytes(16)
-		encryptedData := dbuf.Bytes(dbuf.size - 24)
-		aesKey, aesIV := generateAES(msgKey, m.authKey, true)
-		x, err := doAES256IGEdecrypt(encryptedData, aesKey, aesIV)
+		// padded intermediate transport may add up to 15 bytes
+		encryptedData := dbuf.Bytes((dbuf.size - 24) &^ 15)
+		key, _ := m.sessionKey()
+		x, err := decryptMessage(key, msgKey, encryptedData, true, m.mtproto1)
 		if err != nil {
 			return nil, err
 		}
 		dbuf = NewDecodeBuf(x)
 		_ = dbuf.Long() // salt
-		_ = dbuf.Long() // session_id
+		// a message of another session is dropped, e.g. an answer to the session replaced by newSession
+		if sessionId := dbuf.Long(); sessionId != m.sessionId {
+			return nil, errWrongSession
+		}
 		m.msgId = dbuf.Long()
 		m.seqNo = dbuf.Int()
-		messageLen := dbuf.Int()
-		if int(messageLen) > dbuf.size-32 {
-			return nil, fmt.Errorf("Message len: %d (need less than %d)", messageLen, dbuf.size-32)
-		}
-		if !bytes.Equal(sha1(dbuf.buf[0 : 32+messageLen])[4:20], msgKey) {
-			return nil, errors.New("Wrong msg_key")
-		}
+		_ = dbuf.Int() // message_data_length
 
 		data = dbuf.Object()
 		if data == nil {
@@ -208,72 +310,94 @@ func (m *MTProto) read(stop <-chan struct{}) (interface{}, error) {
 	return data, nil
 }
 
-func (m *MTProto) makeAuthKey() error {
+// maxDHRetries is how many times set_client_DH_params is sent again after dh_gen_retry
+const maxDHRetries = 5
+
+// makeAuthKey runs the DH key exchange and returns the new auth key with its first server salt
+// expiresIn > 0 makes a temporary key living expiresIn seconds
+func (m *MTProto) makeAuthKey(expiresIn int32) (authKey, serverSalt []byte, err error) {
 	var x []byte
-	var err error
 	var data interface{}
 
 	// (send) req_pq
-	nonceFirst := GenerateNonce(16)
-	err = m.sendPacket(TL_req_pq{nonceFirst}, nil)
+	nonceFirst, err := m.randomBytes(16)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	err = m.sendPlain(TL_req_pq{nonceFirst})
+	if err != nil {
+		return nil, nil, err
 	}
 
 	// (parse) resPQ
 	data, err = m.read(nil)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	res, ok := data.(TL_resPQ)
 	if !ok {
-		return errors.New("Handshake: Need resPQ")
+		return nil, nil, errors.New("Handshake: Need resPQ")
 	}
 	if !bytes.Equal(nonceFirst, res.nonce) {
-		return errors.New("Handshake: Wrong nonce")
-	}
-	found := false
-	for _, b := range res.fingerprints {
-		if uint64(b) == telegramPublicKey_FP {
-			found = true
-			break
-		}
+		return nil, nil, errors.New("Handshake: Wrong nonce")
 	}
-	if !found {
-		return errors.New("Handshake: No fingerprint")
+	key, fingerprint := m.keys.find(res.fingerprints)
+	if key == nil {
+		return nil, nil, errors.New("Handshake: No fingerprint")
 	}
 
 	// (encoding) p_q_inner_data
 	p, q := splitPQ(res.pq)
-	nonceSecond := GenerateNonce(32)
+	nonceSecond, err := m.randomBytes(32)
+	if err != nil {
+		return nil, nil, err
+	}
 	nonceServer := res.server_nonce
-	innerData1 := (TL_p_q_inner_data{res.pq, p, q, nonceFirst, nonceServer, nonceSecond}).encode()
+	var innerData1 []byte
+	if expiresIn > 0 {
+		innerData1 = (TL_p_q_inner_data_temp{res.pq, p, q, nonceFirst, nonceServer, nonceSecond, expiresIn}).encode()
+	} else {
+		innerData1 = (TL_p_q_inner_data{res.pq, p, q, nonceFirst, nonceServer, nonceSecond}).encode()
+	}
 
-	x = make([]byte, 255)
+	// sha1 and data padded with random bytes
+	x, err = m.randomBytes(255)
+	if err != nil {
+		return nil, nil, err
+	}
 	copy(x[0:], sha1(innerData1))
 	copy(x[20:], innerData1)
-	encryptedData1 := doRSAencrypt(x)
+	encryptedData1 := doRSAencrypt(x, key)
 
 	// (send) req_DH_params
-	err = m.sendPacket(TL_req_DH_params{nonceFirst, nonceServer, p, q, telegramPublicKey_FP, encryptedData1}, nil)
+	err = m.sendPlain(TL_req_DH_params{nonceFirst, nonceServer, p, q, fingerprint, encryptedData1})
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// (parse) server_DH_params_{ok, fail}
 	data, err = m.read(nil)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if fail, ok := data.(TL_server_DH_params_fail); ok {
+		if !bytes.Equal(nonceFirst, fail.nonce) || !bytes.Equal(nonceServer, fail.server_nonce) {
+			return nil, nil, errors.New("Handshake: Wrong nonce")
+		}
+		if !bytes.Equal(sha1(nonceSecond)[4:20], fail.new_nonce_hash) {
+			return nil, nil, errors.New("Handshake: Wrong new_nonce_hash")
+		}
+		return nil, nil, errors.New("Handshake: server_DH_params_fail")
 	}
 	dh, ok := data.(TL_server_DH_params_ok)
 	if !ok {
-		return errors.New("Handshake: Need server_DH_params_ok")
+		return nil, nil, errors.New("Handshake: Need server_DH_params_ok")
 	}
 	if !bytes.Equal(nonceFirst, dh.nonce) {
-		return errors.New("Handshake: Wrong nonce")
+		return nil, nil, errors.New("Handshake: Wrong nonce")
 	}
 	if !bytes.Equal(nonceServer, dh.server_nonce) {
-		return errors.New("Handshake: Wrong server_nonce")
+		return nil, nil, errors.New("Handshake: Wrong server_nonce")
 	}
 	t1 := make([]byte, 48)
 	copy(t1[0:], nonceSecond)
@@ -303,80 +427,109 @@ func (m *MTProto) makeAuthKey() error {
 	// (parse-thru) server_DH_inner_data
 	decodedData, err := doAES256IGEdecrypt(dh.encrypted_answer, tmpAESKey, tmpAESIV)
 	if err != nil {
-		return err
+		return nil, nil, err
+	}
+	if len(decodedData) < 20 {
+		return nil, nil, errors.New("Handshake: server_DH_inner_data is too short")
 	}
 	innerbuf := NewDecodeBuf(decodedData[20:])
 	data = innerbuf.Object()
 	if innerbuf.err != nil {
-		return innerbuf.err
+		return nil, nil, innerbuf.err
+	}
+	if !bytes.Equal(decodedData[:20], sha1(decodedData[20:20+innerbuf.off])) {
+		return nil, nil, errors.New("Handshake: Wrong server_DH_inner_data hash")
 	}
 	dhi, ok := data.(TL_server_DH_inner_data)
 	if !ok {
-		return errors.New("Handshake: Need server_DH_inner_data")
+		return nil, nil, errors.New("Handshake: Need server_DH_inner_data")
 	}
 	if !bytes.Equal(nonceFirst, dhi.nonce) {
-		return errors.New("Handshake: Wrong nonce")
+		return nil, nil, errors.New("Handshake: Wrong nonce")
 	}
 	if !bytes.Equal(nonceServer, dhi.server_nonce) {
-		return errors.New("Handshake: Wrong server_nonce")
-	}
-
-	_, g_b, g_ab := makeGAB(dhi.g, dhi.g_a, dhi.dh_prime)
-	m.authKey = g_ab.Bytes()
-	if m.authKey[0] == 0 {
-		m.authKey = m.authKey[1:]
-	}
-	m.authKeyHash = sha1(m.authKey)[12:20]
-	t4 := make([]byte, 32+1+8)
-	copy(t4[0:], nonceSecond)
-	t4[32] = 1
-	copy(t4[33:], sha1(m.authKey)[0:8])
-	nonceHash1 := sha1(t4)[4:20]
-	m.serverSalt = make([]byte, 8)
-	copy(m.serverSalt, nonceSecond[:8])
-	xor(m.serverSalt, nonceServer[:8])
-
-	// (encoding) client_DH_inner_data
-	innerData2 := (TL_client_DH_inner_data{nonceFirst, nonceServer, 0, g_b}).encode()
-	x = make([]byte, 20+len(innerData2)+(16-((20+len(innerData2))%16))&15)
-	copy(x[0:], sha1(innerData2))
-	copy(x[20:], innerData2)
-	encryptedData2, err := doAES256IGEencrypt(x, tmpAESKey, tmpAESIV)
-
-	// (send) set_client_DH_params
-	err = m.sendPacket(TL_set_client_DH_params{nonceFirst, nonceServer, encryptedData2}, nil)
-	if err != nil {
-		return err
+		return nil, nil, errors.New("Handshake: Wrong server_nonce")
 	}
-
-	// (parse) dh_gen_{ok, retry, fail}
-	data, err = m.read(nil)
+	err = checkDHParams(dhi.g, dhi.dh_prime)
 	if err != nil {
-		return err
-	}
-	dhg, ok := data.(TL_dh_gen_ok)
-	if !ok {
-		return errors.New("Handshake: Need dh_gen_ok")
+		return nil, nil, err
 	}
-	if !bytes.Equal(nonceFirst, dhg.nonce) {
-		return errors.New("Handshake: Wrong nonce")
-	}
-	if !bytes.Equal(nonceServer, dhg.server_nonce) {
-		return errors.New("Handshake: Wrong server_nonce")
+	if !checkDHValue(dhi.g_a, dhi.dh_prime) {
+		return nil, nil, errors.New("Handshake: Wrong g_a")
 	}
 
-	if !bytes.Equal(nonceHash1, dhg.new_nonce_hash1) {
-		return errors.New("Handshake: Wrong new_nonce_hash1")
-	}
+	// the routines are stopped, Connect and recover send the messages again after the handshake
+	_ = m.setServerTime(int64(dhi.server_time) << 32)
 
-	if __debug&DEBUG_LEVEL_NETWORK != 0 {
-		log.Println("MTProto::makeAuthKey::", reflect.TypeOf(data).String())
-	}
-	// (all ok)
-	err = m.saveData()
-	if err != nil {
-		return err
-	}
+	serverSalt = make([]byte, 8)
+	copy(serverSalt, nonceSecond[:8])
+	xor(serverSalt, nonceServer[:8])
 
-	return nil
+	var retryId int64
+	for retry := 0; ; retry++ {
+		_, g_b, g_ab, err := makeGAB(m.randomSource(), dhi.g, dhi.g_a, dhi.dh_prime)
+		if err != nil {
+			return nil, nil, err
+		}
+		authKey = make([]byte, 256)
+		copy(authKey[256-len(g_ab.Bytes()):], g_ab.Bytes())
+
+		// (encoding) client_DH_inner_data
+		innerData2 := (TL_client_DH_inner_data{nonceFirst, nonceServer, retryId, g_b}).encode()
+		x = make([]byte, 20+len(innerData2)+(16-((20+len(innerData2))%16))&15)
+		copy(x[0:], sha1(innerData2))
+		copy(x[20:], innerData2)
+		encryptedData2, err := doAES256IGEencrypt(x, tmpAESKey, tmpAESIV)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// (send) set_client_DH_params
+		err = m.sendPlain(TL_set_client_DH_params{nonceFirst, nonceServer, encryptedData2})
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// (parse) dh_gen_{ok, retry, fail}
+		data, err = m.read(nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		if __debug&DEBUG_LEVEL_NETWORK != 0 {
+			log.Println("MTProto::makeAuthKey::", reflect.TypeOf(data).String())
+		}
+		switch dhg := data.(type) {
+		case TL_dh_gen_ok:
+			if !bytes.Equal(nonceFirst, dhg.nonce) || !bytes.Equal(nonceServer, dhg.server_nonce) {
+				return nil, nil, errors.New("Handshake: Wrong nonce")
+			}
+			if !bytes.Equal(newNonceHash(nonceSecond, 1, authKey), dhg.new_nonce_hash1) {
+				return nil, nil, errors.New("Handshake: Wrong new_nonce_hash1")
+			}
+			return authKey, serverSalt, nil
+		case TL_dh_gen_retry:
+			if !bytes.Equal(nonceFirst, dhg.nonce) || !bytes.Equal(nonceServer, dhg.server_nonce) {
+				return nil, nil, errors.New("Handshake: Wrong nonce")
+			}
+			if !bytes.Equal(newNonceHash(nonceSecond, 2, authKey), dhg.new_nonce_hash2) {
+				return nil, nil, errors.New("Handshake: Wrong new_nonce_hash2")
+			}
+			if retry >= maxDHRetries {
+				return nil, nil, errors.New("Handshake: Too many dh_gen_retry")
+			}
+			// retry_id is auth_key_aux_hash of the rejected key
+			retryId = int64(binary.LittleEndian.Uint64(sha1(authKey)[0:8]))
+			continue
+		case TL_dh_gen_fail:
+			if !bytes.Equal(nonceFirst, dhg.nonce) || !bytes.Equal(nonceServer, dhg.server_nonce) {
+				return nil, nil, errors.New("Handshake: Wrong nonce")
+			}
+			if !bytes.Equal(newNonceHash(nonceSecond, 3, authKey), dhg.new_nonce_hash3) {
+				return nil, nil, errors.New("Handshake: Wrong new_nonce_hash3")
+			}
+			return nil, nil, errors.New("Handshake: dh_gen_fail")
+		default:
+			return nil, nil, errors.New("Handshake: Need dh_gen_ok")
+		}
+	}
 }
@@ -0,0 +1,168 @@
+package mtproto
+
+import (
+	"crypto/rand"
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestSendPackets(t *testing.T) {
+	authKey := make([]byte, 256)
+	for i := range authKey {
+		authKey[i] = byte(i * 5)
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	m := &MTProto{
+		conn:         client,
+		transport:    NewIntermediateTransport(nil),
+		encrypted:    true,
+		serverSalt:   make([]byte, 8),
+		mutex:        &sync.Mutex{},
+		msgsIdToAck:  make(map[int64]packetToSend),
+		msgsIdToResp: make(map[int64]packetToSend),
+	}
+	m.useAuthKey(authKey)
+
+	// reads the next message written by m
+	read := func() (int64, int32, interface{}) {
+		buf, err := NewIntermediateTransport(nil).ReadPacket(server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := decryptMessage(authKey, buf[8:24], buf[24:], false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := NewDecodeBuf(data[16:])
+		msgId, seqNo := d.Long(), d.Int()
+		_ = d.Int()
+		return msgId, seqNo, d.Object()
+	}
+
+	batch := []packetToSend{
+		{TL_ping{1}, nil},
+		{TL_help_getConfig{}, make(chan TL, 1)},
+		{TL_help_getNearestDc{}, make(chan TL, 1)},
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- m.sendPackets(batch) }()
+	msgId, seqNo, data := read()
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	c, ok := data.(TL_msg_container)
+	if !ok || len(c.items) != 3 {
+		t.Fatalf("got %#v", data)
+	}
+	// every message is content related, the container is not
+	if seqNo != 6 {
+		t.Errorf("container seq_no %d", seqNo)
+	}
+	for i, v := range c.items {
+		if v.msg_id >= msgId {
+			t.Errorf("item %d: msg_id %d is not less than container msg_id %d", i, v.msg_id, msgId)
+		}
+		if v.seq_no != int32(2*i+1) {
+			t.Errorf("item %d: wrong seq_no %d", i, v.seq_no)
+		}
+		if _, ok := m.msgsIdToAck[v.msg_id]; ok != (i > 0) {
+			t.Errorf("item %d: ack tracking %v", i, ok)
+		}
+		if _, ok := m.msgsIdToResp[v.msg_id]; ok != (i > 0) {
+			t.Errorf("item %d: response tracking %v", i, ok)
+		}
+	}
+
+	// messages not fitting into one container are split
+	batch = []packetToSend{
+		{TL_upload_saveFilePart{1, 0, make([]byte, maxContainerSize)}, nil},
+		{TL_ping{2}, nil},
+	}
+	go func() { errs <- m.sendPackets(batch) }()
+	if _, _, data = read(); data == nil {
+		t.Fatal("no message")
+	}
+	if _, ok = data.(TL_msg_container); ok {
+		t.Error("big message is in a container")
+	}
+	if _, _, data = read(); data.(TL_ping).ping_id != 2 {
+		t.Errorf("got %#v", data)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadSessionId(t *testing.T) {
+	authKey := make([]byte, 256)
+	for i := range authKey {
+		authKey[i] = byte(i * 3)
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	m := &MTProto{
+		conn:      client,
+		transport: NewIntermediateTransport(nil),
+		sessionId: 0x1122334455667788,
+	}
+	m.useAuthKey(authKey)
+
+	// write sends a pong of the session as the server would
+	write := func(sessionId int64) {
+		body := TL_pong{msg_id: 4, ping_id: 5}.encode()
+		z := NewEncodeBuf(32 + len(body))
+		z.Long(0) // salt
+		z.Long(sessionId)
+		z.Long(0x1001) // server msg_id
+		z.Int(0)
+		z.Int(int32(len(body)))
+		z.Bytes(body)
+		msgKey, encrypted, err := encryptMessage(rand.Reader, authKey, z.buf, true, false)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		x := NewEncodeBuf(24 + len(encrypted))
+		x.Bytes(m.authKeyHash)
+		x.Bytes(msgKey)
+		x.Bytes(encrypted)
+		if err = NewIntermediateTransport(nil).WritePacket(server, x.buf); err != nil {
+			t.Error(err)
+		}
+	}
+
+	go write(m.sessionId)
+	data, err := m.read(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pong, ok := data.(TL_pong); !ok || pong.ping_id != 5 {
+		t.Errorf("got %#v", data)
+	}
+
+	go write(m.sessionId + 1)
+	if data, err = m.read(nil); err != errWrongSession {
+		t.Errorf("message of another session: %#v, %v", data, err)
+	}
+}
+
+func TestPendingAcks(t *testing.T) {
+	m := &MTProto{mutex: &sync.Mutex{}}
+	for i := int64(0); i < 2*maxAcks+10; i++ {
+		// content related messages only
+		m.process(i*4+1, int32(i&1), TL_pong{})
+	}
+	if acks := m.pendingAcks(); len(acks) != maxAcks || acks[0] != 5 {
+		t.Errorf("got %d acks", len(acks))
+	}
+	if acks := m.pendingAcks(); len(acks) != 5 {
+		t.Errorf("got %d acks", len(acks))
+	}
+	if acks := m.pendingAcks(); len(acks) != 0 {
+		t.Errorf("acks are not flushed: %v", acks)
+	}
+}
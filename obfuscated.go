@@ -0,0 +1,126 @@
+package mtproto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// taggedTransport is a framing usable inside obfuscated2, tag is put to the init header
+type taggedTransport interface {
+	Transport
+	tag() []byte
+}
+
+// NewObfuscatedTransport wraps the abridged or (padded) intermediate framing with obfuscated2:
+// a random 64-byte init header and AES-256-CTR encryption of the whole connection
+// https://core.telegram.org/mtproto/mtproto-transports#transport-obfuscation
+// e.g. WithTransport(NewObfuscatedTransport(NewIntermediateTransport))
+func NewObfuscatedTransport(inner NewTransport) NewTransport {
+	return func(rnd io.Reader) Transport {
+		return &obfuscatedTransport{inner: inner(rnd), rnd: rnd}
+	}
+}
+
+type obfuscatedTransport struct {
+	inner Transport
+	// MTProxy secret and the DC to connect through the proxy
+	secret []byte
+	dc     int16
+	// rnd is the source of the init header
+	rnd io.Reader
+
+	encrypt cipher.Stream
+	decrypt cipher.Stream
+}
+
+func (t *obfuscatedTransport) Init(w io.Writer) error {
+	inner, ok := t.inner.(taggedTransport)
+	if !ok {
+		return fmt.Errorf("Transport: %T can not be obfuscated", t.inner)
+	}
+	header, err := obfuscatedHeader(t.rnd, inner.tag())
+	if err != nil {
+		return err
+	}
+	if t.dc != 0 {
+		binary.LittleEndian.PutUint16(header[60:], uint16(t.dc))
+	}
+
+	t.encrypt, err = newCTR(obfuscatedKey(header[8:40], t.secret), header[40:56])
+	if err != nil {
+		return err
+	}
+	reversed := reverseBytes(header[8:56])
+	t.decrypt, err = newCTR(obfuscatedKey(reversed[:32], t.secret), reversed[32:48])
+	if err != nil {
+		return err
+	}
+
+	// the tag and the rest are sent encrypted
+	encrypted := make([]byte, len(header))
+	t.encrypt.XORKeyStream(encrypted, header)
+	copy(header[56:], encrypted[56:])
+	_, err = w.Write(header)
+	return err
+}
+
+func (t *obfuscatedTransport) WritePacket(w io.Writer, data []byte) error {
+	return t.inner.WritePacket(cipher.StreamWriter{S: t.encrypt, W: w}, data)
+}
+
+func (t *obfuscatedTransport) ReadPacket(r io.Reader) ([]byte, error) {
+	return t.inner.ReadPacket(cipher.StreamReader{S: t.decrypt, R: r})
+}
+
+// obfuscatedHeader makes the random init header, it must not look like another protocol
+func obfuscatedHeader(rnd io.Reader, tag []byte) ([]byte, error) {
+	header := make([]byte, 64)
+	for {
+		_, err := io.ReadFull(rnd, header)
+		if err != nil {
+			return nil, err
+		}
+		first := binary.LittleEndian.Uint32(header)
+		if header[0] == 0xef || binary.LittleEndian.Uint32(header[4:]) == 0 {
+			continue
+		}
+		switch first {
+		case 0x44414548, 0x54534f50, 0x20544547, 0x4954504f, // HEAD, POST, GET, OPTI
+			0xdddddddd, 0xeeeeeeee, 0x02010316: // intermediate tags, TLS
+			continue
+		}
+		break
+	}
+	copy(header[56:60], tag)
+	return header, nil
+}
+
+// obfuscatedKey is the key from the header, with MTProxy it is SHA256(key + secret)
+func obfuscatedKey(key, secret []byte) []byte {
+	if secret == nil {
+		return key
+	}
+	sum := sha256.Sum256(append(bytes.Clone(key), secret...))
+	return sum[:]
+}
+
+func newCTR(key, iv []byte) (cipher.Stream, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, iv), nil
+}
+
+func reverseBytes(b []byte) []byte {
+	r := bytes.Clone(b)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return r
+}
@@ -0,0 +1,99 @@
+package mtproto
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// obfuscatedEcho is the server side of obfuscated2, it sends every packet back
+// With MTProxy secret the DC in the header must be dc
+func obfuscatedEcho(conn net.Conn, inner Transport, secret []byte, dc int16) error {
+	defer conn.Close()
+	header := make([]byte, 64)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	decrypt, err := newCTR(obfuscatedKey(header[8:40], secret), header[40:56])
+	if err != nil {
+		return err
+	}
+	reversed := reverseBytes(header[8:56])
+	encrypt, err := newCTR(obfuscatedKey(reversed[:32], secret), reversed[32:48])
+	if err != nil {
+		return err
+	}
+	plain := make([]byte, 64)
+	decrypt.XORKeyStream(plain, header)
+	if !bytes.Equal(plain[56:60], inner.(taggedTransport).tag()) {
+		return errors.New("wrong tag")
+	}
+	if secret != nil && int16(binary.LittleEndian.Uint16(plain[60:])) != dc {
+		return errors.New("wrong DC")
+	}
+
+	r := cipher.StreamReader{S: decrypt, R: conn}
+	w := cipher.StreamWriter{S: encrypt, W: conn}
+	for {
+		data, err := inner.ReadPacket(r)
+		if err != nil {
+			return err
+		}
+		if err = inner.WritePacket(w, data); err != nil {
+			return err
+		}
+	}
+}
+
+func TestObfuscatedTransport(t *testing.T) {
+	for _, inner := range []NewTransport{NewAbridgedTransport, NewIntermediateTransport} {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				done <- err
+				return
+			}
+			done <- obfuscatedEcho(conn, inner(rand.Reader), nil, 0)
+		}()
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		transport := NewObfuscatedTransport(inner)(rand.Reader)
+		if err := transport.Init(conn); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range [][]byte{bytes.Repeat([]byte{1, 2, 3, 4}, 3), bytes.Repeat([]byte{9, 8, 7, 6}, 5000)} {
+			if err := transport.WritePacket(conn, p); err != nil {
+				t.Fatal(err)
+			}
+			got, err := transport.ReadPacket(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, p) {
+				t.Errorf("echo mismatch, %d bytes", len(got))
+			}
+		}
+		conn.Close()
+		if err := <-done; err != io.EOF {
+			t.Errorf("server: %v", err)
+		}
+		l.Close()
+	}
+
+	if err := NewObfuscatedTransport(NewFullTransport)(rand.Reader).Init(io.Discard); err == nil {
+		t.Error("full transport obfuscated")
+	}
+}
@@ -0,0 +1,109 @@
+package mtproto
+
+import (
+	"io"
+	"time"
+)
+
+// Option configures MTProto in NewMTProto and NewMTProtoWithStorage
+type Option func(m *MTProto)
+
+// WithBackoff sets delays between reconnection attempts, DefaultBackoff is used otherwise
+func WithBackoff(b Backoff) Option {
+	return func(m *MTProto) {
+		m.backoff = b
+	}
+}
+
+// WithRequestTimeout sets the timeout of manager methods, DefaultRequestTimeout is used otherwise
+// Zero disables the timeout
+func WithRequestTimeout(d time.Duration) Option {
+	return func(m *MTProto) {
+		m.requestTimeout = d
+	}
+}
+
+// WithMiddleware wraps Invoke, and therefore every manager method, with the middlewares
+// The first middleware is the outermost one
+func WithMiddleware(mw ...Middleware) Option {
+	return func(m *MTProto) {
+		m.middlewares = append(m.middlewares, mw...)
+	}
+}
+
+// WithTransport sets the TCP framing, e.g. WithTransport(NewIntermediateTransport)
+// NewAbridgedTransport is used otherwise
+func WithTransport(t NewTransport) Option {
+	return func(m *MTProto) {
+		m.newTransport = t
+	}
+}
+
+// WithDialer opens the connections with d, e.g. NewSOCKS5Dialer
+// net.Dialer is used otherwise
+func WithDialer(d ContextDialer) Option {
+	return func(m *MTProto) {
+		m.dialer = d
+	}
+}
+
+// WithMTProxy connects to every DC through the proxy, the proxy is dialed with the WithDialer dialer
+// WithTransport is ignored, the proxy uses obfuscated2 with (padded) intermediate framing
+func WithMTProxy(p *MTProxy) Option {
+	return func(m *MTProto) {
+		m.proxy = p
+	}
+}
+
+// WithWebSocket connects to the DCs over WebSocket with the binary subprotocol,
+// endpoint returns the URL of the DC, e.g. WebSocketEndpoint or WebSocketTestEndpoint
+// The framing set with WithTransport is obfuscated, WithMTProxy is ignored
+func WithWebSocket(endpoint func(dc int32) string) Option {
+	return func(m *MTProto) {
+		m.wsEndpoint = endpoint
+	}
+}
+
+// WithMTProto1 encrypts messages with the deprecated MTProto 1.0 scheme instead of MTProto 2.0
+func WithMTProto1() Option {
+	return func(m *MTProto) {
+		m.mtproto1 = true
+	}
+}
+
+// WithPFS enables perfect forward secrecy: messages are encrypted with temporary auth keys living ttl,
+// bound to the permanent key with auth.bindTempAuthKey and renewed a minute before expiry
+// Only the permanent key is saved to the session storage, ttl is at least two minutes
+func WithPFS(ttl time.Duration) Option {
+	return func(m *MTProto) {
+		if ttl < 2*tempKeyRenewBefore {
+			ttl = 2 * tempKeyRenewBefore
+		}
+		m.tempKeyTTL = ttl
+	}
+}
+
+// WithPublicKeys makes the handshake use the keys of r instead of ProductionKeys or TestKeys
+func WithPublicKeys(r *KeyRing) Option {
+	return func(m *MTProto) {
+		m.keys = r
+	}
+}
+
+// WithTestServers connects to the Telegram test servers with their keys, the default address is test DC 2
+// Sessions are marked, a session saved with the production servers is not loaded and vice versa
+func WithTestServers() Option {
+	return func(m *MTProto) {
+		m.testServers = true
+	}
+}
+
+// WithRandom reads nonces, the DH secret, session ids, padding and random_ids from r instead of crypto/rand,
+// e.g. a deterministic source in tests. r must be cryptographically secure otherwise
+func WithRandom(r io.Reader) Option {
+	// the pool connections apply the option again, they must share the lock
+	lr := &lockedReader{r: r}
+	return func(m *MTProto) {
+		m.random = lr
+	}
+}
@@ -0,0 +1,159 @@
+package mtproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// tempKeyRenewBefore is how long before expiry a temporary key is replaced
+const tempKeyRenewBefore = time.Minute
+
+var errTempKeyExpiring = errors.New("Temporary auth key expires")
+
+// sessionKey returns the key messages are encrypted with: the temporary key with PFS, else the permanent one
+func (m *MTProto) sessionKey() (key, keyHash []byte) {
+	if m.tempKey != nil {
+		return m.tempKey, m.tempKeyHash
+	}
+	return m.authKey, m.authKeyHash
+}
+
+// makeTempKey makes a new temporary key, it is used after bindTempKey
+func (m *MTProto) makeTempKey() error {
+	expires := time.Now().Add(m.tempKeyTTL)
+	key, salt, err := m.makeAuthKey(int32(m.tempKeyTTL / time.Second))
+	if err != nil {
+		return err
+	}
+	m.tempKey = key
+	m.tempKeyHash = sha1(key)[12:20]
+	m.tempKeyExpires = expires
+	m.tempKeyBound = false
+	m.resetSalts(salt)
+	return nil
+}
+
+// dropTempKey forgets the temporary key, a new one is made on dial
+func (m *MTProto) dropTempKey() {
+	m.tempKey = nil
+	m.tempKeyHash = nil
+	m.tempKeyExpires = time.Time{}
+	m.tempKeyBound = false
+}
+
+// tempKeyExpiring reports whether the temporary key has to be replaced
+func (m *MTProto) tempKeyExpiring() bool {
+	return m.tempKeyTTL > 0 && time.Until(m.tempKeyExpires) < tempKeyRenewBefore
+}
+
+// tempKeyRenewal fires when the temporary key has to be replaced, it is nil without PFS
+func (m *MTProto) tempKeyRenewal() <-chan time.Time {
+	m.reconnectMutex.Lock()
+	defer m.reconnectMutex.Unlock()
+	if m.tempKeyTTL == 0 {
+		return nil
+	}
+	return time.After(time.Until(m.tempKeyExpires) - tempKeyRenewBefore)
+}
+
+// bindTempKey sends auth.bindTempAuthKey for a new temporary key
+// It is called before the routines start, so the binding is the first message encrypted with the key,
+// the result comes to the returned channel, see waitTempKeyBound
+func (m *MTProto) bindTempKey() (chan TL, error) {
+	if m.tempKey == nil || m.tempKeyBound {
+		return nil, nil
+	}
+	nonce, err := m.randomInt64()
+	if err != nil {
+		return nil, err
+	}
+	resp := make(chan TL, 1)
+	err = m.sendPacket(tempKeyBinding{
+		permKey:     m.authKey,
+		tempKeyHash: m.tempKeyHash,
+		sessionId:   m.sessionId,
+		nonce:       nonce,
+		expiresAt:   int32(m.tempKeyExpires.Unix()),
+		random:      m.randomSource(),
+	}, resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// waitTempKeyBound waits for the result of bindTempKey
+// A key that failed to bind is dropped, the next dial makes a new one
+func (m *MTProto) waitTempKeyBound(resp chan TL) error {
+	if resp == nil {
+		return nil
+	}
+	select {
+	case x := <-resp:
+		if !toBool(x) {
+			m.dropTempKey()
+			return fmt.Errorf("auth.bindTempAuthKey: %#v", x)
+		}
+		m.tempKeyBound = true
+		return nil
+	case <-time.After(dialTimeout):
+		m.dropTempKey()
+		return errors.New("auth.bindTempAuthKey: timeout")
+	}
+}
+
+// tempKeyBinding is auth.bindTempAuthKey, its encrypted message contains the msg_id of the request,
+// so sendPacket makes the request with request
+type tempKeyBinding struct {
+	permKey     []byte
+	tempKeyHash []byte
+	sessionId   int64
+	nonce       int64
+	expiresAt   int32
+	random      io.Reader
+}
+
+func (e tempKeyBinding) encode() []byte { return nil }
+
+// request encrypts bind_auth_key_inner with the permanent key as an MTProto 1.0 message
+// A random int128 takes place of salt and session_id, seq_no is 0
+func (e tempKeyBinding) request(msgId int64) (TL, error) {
+	permKeyHash := sha1(e.permKey)[12:20]
+	permKeyId := int64(binary.LittleEndian.Uint64(permKeyHash))
+	inner := TL_bind_auth_key_inner{
+		nonce:            e.nonce,
+		temp_auth_key_id: int64(binary.LittleEndian.Uint64(e.tempKeyHash)),
+		perm_auth_key_id: permKeyId,
+		temp_session_id:  e.sessionId,
+		expires_at:       e.expiresAt,
+	}.encode()
+
+	random16 := make([]byte, 16)
+	if _, err := io.ReadFull(e.random, random16); err != nil {
+		return nil, err
+	}
+	z := NewEncodeBuf(96)
+	z.Bytes(random16)
+	z.Long(msgId)
+	z.Int(0)
+	z.Int(int32(len(inner)))
+	z.Bytes(inner)
+	msgKey, encryptedData, err := encryptMessage(e.random, e.permKey, z.buf, false, true)
+	if err != nil {
+		return nil, err
+	}
+
+	x := NewEncodeBuf(24 + len(encryptedData))
+	x.Bytes(permKeyHash)
+	x.Bytes(msgKey)
+	x.Bytes(encryptedData)
+	return TL_auth_bindTempAuthKey{
+		Perm_auth_key_id:  permKeyId,
+		Nonce:             e.nonce,
+		Expires_at:        e.expiresAt,
+		Encrypted_message: x.buf,
+	}, nil
+}
@@ -0,0 +1,58 @@
+package mtproto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+)
+
+func TestTempKeyBinding(t *testing.T) {
+	permKey := make([]byte, 256)
+	tempKey := make([]byte, 256)
+	for i := range permKey {
+		permKey[i] = byte(i * 3)
+		tempKey[i] = byte(i * 7)
+	}
+	b := tempKeyBinding{
+		permKey:     permKey,
+		tempKeyHash: sha1(tempKey)[12:20],
+		sessionId:   0x1122334455667788,
+		nonce:       42,
+		expiresAt:   1700000000,
+		random:      rand.Reader,
+	}
+	const msgId = 0x5a5a5a5a00000004
+
+	x, err := b.request(msgId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, ok := x.(TL_auth_bindTempAuthKey)
+	if !ok {
+		t.Fatalf("got %T", x)
+	}
+	permKeyHash := sha1(permKey)[12:20]
+	if req.Perm_auth_key_id != int64(binary.LittleEndian.Uint64(permKeyHash)) || req.Nonce != 42 || req.Expires_at != 1700000000 {
+		t.Errorf("wrong request: %+v", req)
+	}
+
+	// auth_key_id + msg_key + MTProto 1.0 message
+	enc := req.Encrypted_message
+	if !bytes.Equal(enc[:8], permKeyHash) {
+		t.Fatal("wrong auth_key_id")
+	}
+	data, err := decryptMessage(permKey, enc[8:24], enc[24:], false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDecodeBuf(data)
+	_ = d.Bytes(16) // random
+	if d.Long() != msgId || d.Int() != 0 {
+		t.Error("wrong msg_id or seq_no")
+	}
+	inner := TL_bind_auth_key_inner{42, int64(binary.LittleEndian.Uint64(sha1(tempKey)[12:20])), req.Perm_auth_key_id, b.sessionId, b.expiresAt}.encode()
+	if d.Int() != int32(len(inner)) || !bytes.Equal(d.Bytes(len(inner)), inner) {
+		t.Error("wrong bind_auth_key_inner")
+	}
+}
@@ -0,0 +1,295 @@
+package mtproto
+
+import (
+	"context"
+	"crypto/rsa"
+	"fmt"
+)
+
+const RPC_ERROR_AUTH_KEY_UNREGISTERED = "AUTH_KEY_UNREGISTERED"
+
+// InvokeDC sends the request to the given DC
+// Connections to DCs other than the home one are made on first use,
+// the authorization is transferred with auth.exportAuthorization/auth.importAuthorization
+func (m *MTProto) InvokeDC(ctx context.Context, dc int32, req TL) (TL, error) {
+	if m.parent != nil {
+		return m.parent.InvokeDC(ctx, dc, req)
+	}
+	if dc == 0 || dc == m.dcId {
+		return m.Invoke(ctx, req)
+	}
+
+	conn, err := m.dcConn(ctx, dc)
+	if err != nil {
+		return nil, err
+	}
+	x, err := conn.Invoke(ctx, req)
+	rpcErr, ok := AsRPCError(err)
+	if ok && rpcErr.Type == RPC_ERROR_AUTH_KEY_UNREGISTERED {
+		// the reused key has lost its authorization
+		err = m.importAuthorization(ctx, conn, dc)
+		if err != nil {
+			return nil, err
+		}
+		return conn.Invoke(ctx, req)
+	}
+	return x, err
+}
+
+// poolKey identifies a pool connection, CDN DCs have a pool of their own
+type poolKey struct {
+	dc  int32
+	cdn bool
+}
+
+// lockPool serializes the connects to one DC, the connects to other DCs go on meanwhile
+// It gives up when ctx is done, the returned func unlocks
+func (m *MTProto) lockPool(ctx context.Context, dc int32, cdn bool) (func(), error) {
+	m.poolMutex.Lock()
+	key := poolKey{dc, cdn}
+	lock, ok := m.poolLocks[key]
+	if !ok {
+		if m.poolLocks == nil {
+			m.poolLocks = make(map[poolKey]chan struct{})
+		}
+		lock = make(chan struct{}, 1)
+		m.poolLocks[key] = lock
+	}
+	m.poolMutex.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dcConn returns the pool connection to dc, connecting if needed
+func (m *MTProto) dcConn(ctx context.Context, dc int32) (*MTProto, error) {
+	unlock, err := m.lockPool(ctx, dc, false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	m.poolMutex.Lock()
+	conn, ok := m.pool[dc]
+	m.poolMutex.Unlock()
+	if ok {
+		return conn, nil
+	}
+	addr, ok := m.dcList()[dc]
+	if !ok {
+		return nil, fmt.Errorf("Wrong DC index: %d", dc)
+	}
+
+	conn, err = NewMTProtoWithStorage(m.appId, m.appHash, &dcSessionStorage{m, dc}, addr, __debug, m.opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn.parent = m
+	conn.dcId = dc
+	newKey := !conn.encrypted
+	err = conn.Connect()
+	if err != nil {
+		return nil, err
+	}
+	// updates come through the home connection
+	go func(updates chan TL_updates) {
+		for range updates {
+		}
+	}(conn.Updates)
+
+	if newKey {
+		err = m.importAuthorization(ctx, conn, dc)
+		if err != nil {
+			_ = conn.Disconnect()
+			return nil, err
+		}
+	}
+
+	m.poolMutex.Lock()
+	if m.pool == nil {
+		m.pool = make(map[int32]*MTProto)
+	}
+	m.pool[dc] = conn
+	m.poolMutex.Unlock()
+	return conn, nil
+}
+
+// cdnConn returns the connection to CDN dc, connecting if needed
+// CDN DCs get no authorization and their keys are not saved
+func (m *MTProto) cdnConn(ctx context.Context, dc int32) (*MTProto, error) {
+	if m.parent != nil {
+		return m.parent.cdnConn(ctx, dc)
+	}
+	unlock, err := m.lockPool(ctx, dc, true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	m.poolMutex.Lock()
+	conn, ok := m.cdnPool[dc]
+	m.poolMutex.Unlock()
+	if ok {
+		return conn, nil
+	}
+	addr, ok := m.cdnList()[dc]
+	if !ok {
+		return nil, fmt.Errorf("Wrong CDN DC index: %d", dc)
+	}
+	key, err := m.cdnKey(ctx, dc)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err = NewMTProtoWithStorage(m.appId, m.appHash, NewMemorySessionStorage(), addr, __debug, m.opts...)
+	if err != nil {
+		return nil, err
+	}
+	conn.parent = m
+	conn.dcId = dc
+	conn.cdn = true
+	conn.tempKeyTTL = 0
+	conn.keys = NewKeyRing(key)
+	err = conn.Connect()
+	if err != nil {
+		return nil, err
+	}
+	go func(updates chan TL_updates) {
+		for range updates {
+		}
+	}(conn.Updates)
+
+	m.poolMutex.Lock()
+	if m.cdnPool == nil {
+		m.cdnPool = make(map[int32]*MTProto)
+	}
+	m.cdnPool[dc] = conn
+	m.poolMutex.Unlock()
+	return conn, nil
+}
+
+// cdnKey returns the RSA key of CDN dc, the keys are loaded with help.getCdnConfig once
+func (m *MTProto) cdnKey(ctx context.Context, dc int32) (*rsa.PublicKey, error) {
+	m.poolMutex.Lock()
+	keys := m.cdnKeys
+	m.poolMutex.Unlock()
+	if keys == nil {
+		x, err := m.Invoke(ctx, TL_help_getCdnConfig{})
+		if err != nil {
+			return nil, err
+		}
+		config, ok := x.(TL_cdnConfig)
+		if !ok {
+			return nil, fmt.Errorf("RPC: %#v", x)
+		}
+		keys = make(map[int32]*rsa.PublicKey, len(config.Public_keys))
+		for _, v := range config.Public_keys {
+			v := v.(TL_cdnPublicKey)
+			key, err := parsePublicKey([]byte(v.Public_key))
+			if err != nil {
+				return nil, fmt.Errorf("CDN DC %d: %s", v.Dc_id, err)
+			}
+			keys[v.Dc_id] = key
+		}
+		m.poolMutex.Lock()
+		m.cdnKeys = keys
+		m.poolMutex.Unlock()
+	}
+	key, ok := keys[dc]
+	if !ok {
+		return nil, fmt.Errorf("No public key for CDN DC %d", dc)
+	}
+	return key, nil
+}
+
+func (m *MTProto) importAuthorization(ctx context.Context, conn *MTProto, dc int32) error {
+	x, err := m.Invoke(ctx, TL_auth_exportAuthorization{dc})
+	if err != nil {
+		return err
+	}
+	auth, ok := x.(TL_auth_exportedAuthorization)
+	if !ok {
+		return fmt.Errorf("RPC: %#v", x)
+	}
+	_, err = conn.Invoke(ctx, TL_auth_importAuthorization{auth.Id, auth.Bytes})
+	return err
+}
+
+func (m *MTProto) closePool() {
+	m.poolMutex.Lock()
+	defer m.poolMutex.Unlock()
+	for dc, conn := range m.pool {
+		_ = conn.Disconnect()
+		delete(m.pool, dc)
+	}
+	for dc, conn := range m.cdnPool {
+		_ = conn.Disconnect()
+		delete(m.cdnPool, dc)
+	}
+}
+
+func (m *MTProto) dcKey(dc int32) []byte {
+	m.dcKeysMutex.Lock()
+	defer m.dcKeysMutex.Unlock()
+	return m.dcKeys[dc]
+}
+
+// setDcKey stores the auth key of dc, nil key removes it
+func (m *MTProto) setDcKey(dc int32, key []byte) {
+	m.dcKeysMutex.Lock()
+	defer m.dcKeysMutex.Unlock()
+	if key == nil {
+		delete(m.dcKeys, dc)
+		return
+	}
+	if m.dcKeys == nil {
+		m.dcKeys = make(map[int32][]byte)
+	}
+	m.dcKeys[dc] = key
+}
+
+func (m *MTProto) copyDcKeys() map[int32][]byte {
+	m.dcKeysMutex.Lock()
+	defer m.dcKeysMutex.Unlock()
+	keys := make(map[int32][]byte, len(m.dcKeys))
+	for dc, key := range m.dcKeys {
+		keys[dc] = key
+	}
+	return keys
+}
+
+// dcSessionStorage keeps the auth key of a pool connection in the home session
+type dcSessionStorage struct {
+	home *MTProto
+	dc   int32
+}
+
+func (s *dcSessionStorage) Load() (*Session, error) {
+	key := s.home.dcKey(s.dc)
+	if key == nil {
+		return nil, ErrSessionNotFound
+	}
+	return &Session{
+		AuthKey:     key,
+		AuthKeyHash: sha1(key)[12:20],
+		// the real salt comes with bad_server_salt
+		ServerSalt:  make([]byte, 8),
+		Addr:        s.home.dcList()[s.dc],
+		DcID:        s.dc,
+		TestServers: s.home.testServers,
+	}, nil
+}
+
+func (s *dcSessionStorage) Save(session *Session) error {
+	s.home.setDcKey(s.dc, session.AuthKey)
+	return s.home.saveData()
+}
+
+func (s *dcSessionStorage) Delete() error {
+	s.home.setDcKey(s.dc, nil)
+	return s.home.saveData()
+}
@@ -0,0 +1,88 @@
+package mtproto
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLockPool(t *testing.T) {
+	m := &MTProto{}
+	bg := context.Background()
+	unlock, err := m.lockPool(bg, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a connect to DC 2 does not block the other DCs and the CDN DC with the same id
+	for _, key := range []poolKey{{4, false}, {2, true}} {
+		other, err := m.lockPool(bg, key.dc, key.cdn)
+		if err != nil {
+			t.Fatalf("%v: %s", key, err)
+		}
+		other()
+	}
+
+	ctx, cancel := context.WithTimeout(bg, 50*time.Millisecond)
+	defer cancel()
+	if _, err = m.lockPool(ctx, 2, false); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("locked twice: %v", err)
+	}
+
+	unlock()
+	unlock, err = m.lockPool(bg, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+}
+
+func TestDcSessionStorageDcList(t *testing.T) {
+	home := newServiceTestMTProto()
+	home.storage = NewMemorySessionStorage()
+	home.setDcKey(4, make([]byte, 256))
+	storage := &dcSessionStorage{home, 4}
+
+	// a pool connection loads its session from a worker goroutine while initConnection replaces the DC list,
+	// go test -race tells if the list is read without the lock
+	started, done := make(chan struct{}), make(chan struct{})
+	loaded := make(chan error, 1)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				loaded <- nil
+				return
+			default:
+			}
+			if _, err := storage.Load(); err != nil {
+				loaded <- err
+				return
+			}
+			if i == 0 {
+				close(started)
+			}
+		}
+	}()
+	go func() {
+		x := <-home.queueSend
+		<-started
+		x.resp <- TL_config{This_dc: 2, Dc_options: []TL{
+			TL_dcOption{Id: 2, Ip_address: "149.154.167.51", Port: 443},
+			TL_dcOption{Id: 4, Ip_address: "149.154.167.91", Port: 443},
+		}}
+	}()
+	err := home.initConnection()
+	close(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = <-loaded; err != nil {
+		t.Fatal(err)
+	}
+	s, err := storage.Load()
+	if err != nil || s.Addr != "149.154.167.91:443" {
+		t.Errorf("got %+v, %v", s, err)
+	}
+}
@@ -0,0 +1,48 @@
+package mtproto
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sync"
+)
+
+// lockedReader serializes reads, the random source of WithRandom is shared by the pool connections
+type lockedReader struct {
+	mutex sync.Mutex
+	r     io.Reader
+}
+
+func (l *lockedReader) Read(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.r.Read(p)
+}
+
+// randomSource returns the source of nonces, the DH secret, session ids, padding and random_ids:
+// the WithRandom reader or crypto/rand
+func (m *MTProto) randomSource() io.Reader {
+	if m.random != nil {
+		return m.random
+	}
+	return rand.Reader
+}
+
+// randomBytes returns n random bytes
+func (m *MTProto) randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(m.randomSource(), b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// randomInt64 returns a random int64, e.g. for random_id
+func (m *MTProto) randomInt64() (int64, error) {
+	b, err := m.randomBytes(8)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(b)), nil
+}
@@ -0,0 +1,92 @@
+package mtproto
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestWithRandom(t *testing.T) {
+	newConn := func() *MTProto {
+		m, err := NewMTProtoWithStorage(1, "hash", NewMemorySessionStorage(), "", 0, WithRandom(rand.New(rand.NewSource(1))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	m1, m2 := newConn(), newConn()
+	if m1.sessionId != m2.sessionId {
+		t.Error("session ids of the same source differ")
+	}
+
+	authKey := make([]byte, 256)
+	data := make([]byte, 48)
+	var encrypted [][]byte
+	for _, m := range []*MTProto{m1, m2} {
+		_, x, err := encryptMessage(m.randomSource(), authKey, data, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encrypted = append(encrypted, x)
+	}
+	if !bytes.Equal(encrypted[0], encrypted[1]) {
+		t.Error("padding of the same source differs")
+	}
+
+	// a failed source is an error, not zero bytes
+	_, err := NewMTProtoWithStorage(1, "hash", NewMemorySessionStorage(), "", 0, WithRandom(bytes.NewReader(make([]byte, 4))))
+	if err == nil {
+		t.Error("no error with an exhausted random source")
+	}
+
+	// the transports read the padding, the obfuscated header and the WebSocket mask from the source too
+	var conn bytes.Buffer
+	empty := bytes.NewReader(nil)
+	if err = NewPaddedIntermediateTransport(empty).WritePacket(&conn, make([]byte, 16)); err == nil {
+		t.Error("padded intermediate: no error with an exhausted random source")
+	}
+	if err = NewObfuscatedTransport(NewAbridgedTransport)(empty).Init(&conn); err == nil {
+		t.Error("obfuscated: no error with an exhausted random source")
+	}
+	if _, err = newWSConn(nil, nil, empty).Write([]byte{1}); err == nil {
+		t.Error("WebSocket: no error with an exhausted random source")
+	}
+
+	m := &MTProto{}
+	x, err := m.randomBytes(32)
+	if err != nil || bytes.Equal(x, make([]byte, 32)) {
+		t.Errorf("crypto/rand: %x, %v", x, err)
+	}
+}
+
+func TestWithRandomPool(t *testing.T) {
+	home, err := NewMTProtoWithStorage(1, "hash", NewMemorySessionStorage(), "", 0, WithRandom(rand.New(rand.NewSource(1))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a pool connection is made with the options of the home one, see dcConn
+	conn, err := NewMTProtoWithStorage(1, "hash", NewMemorySessionStorage(), "", 0, home.opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.random != home.random {
+		t.Fatal("pool connection has a lock of its own")
+	}
+
+	// math/rand.Rand is not safe for concurrent use, go test -race tells if the reads are not serialized
+	var wg sync.WaitGroup
+	for _, m := range []*MTProto{home, conn} {
+		wg.Add(1)
+		go func(m *MTProto) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if _, err := m.randomBytes(16); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(m)
+	}
+	wg.Wait()
+}
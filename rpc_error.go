@@ -0,0 +1,79 @@
+package mtproto
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RPC_ERROR_FLOOD_WAIT              = "FLOOD_WAIT"
+	RPC_ERROR_PHONE_MIGRATE           = "PHONE_MIGRATE"
+	RPC_ERROR_NETWORK_MIGRATE         = "NETWORK_MIGRATE"
+	RPC_ERROR_USER_MIGRATE            = "USER_MIGRATE"
+	RPC_ERROR_FILE_MIGRATE            = "FILE_MIGRATE"
+	RPC_ERROR_STATS_MIGRATE           = "STATS_MIGRATE"
+	RPC_ERROR_SESSION_PASSWORD_NEEDED = "SESSION_PASSWORD_NEEDED"
+)
+
+// RPCError is returned by Invoke when the server answers with rpc_error
+//
+//	Message is the original error_message, e.g. FLOOD_WAIT_30
+//	Type is the message without the numeric suffix, e.g. FLOOD_WAIT
+//	Argument is the numeric suffix, e.g. 30, zero if there is none
+type RPCError struct {
+	Code     int32
+	Message  string
+	Type     string
+	Argument int32
+}
+
+func NewRPCError(code int32, message string) *RPCError {
+	e := &RPCError{Code: code, Message: message, Type: message}
+	idx := strings.LastIndex(message, "_")
+	if idx > 0 {
+		n, err := strconv.ParseInt(message[idx+1:], 10, 32)
+		if err == nil {
+			e.Type = message[:idx]
+			e.Argument = int32(n)
+		}
+	}
+	return e
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("TL_rpc_error: %d - %s", e.Code, e.Message)
+}
+
+// FloodWait returns the time to wait before repeating the request
+func (e *RPCError) FloodWait() (time.Duration, bool) {
+	if e.Type != RPC_ERROR_FLOOD_WAIT {
+		return 0, false
+	}
+	return time.Duration(e.Argument) * time.Second, true
+}
+
+// MigrateDC returns the DC the request must be repeated on
+func (e *RPCError) MigrateDC() (int32, bool) {
+	switch e.Type {
+	case RPC_ERROR_PHONE_MIGRATE, RPC_ERROR_NETWORK_MIGRATE, RPC_ERROR_USER_MIGRATE,
+		RPC_ERROR_FILE_MIGRATE, RPC_ERROR_STATS_MIGRATE:
+		return e.Argument, true
+	}
+	return 0, false
+}
+
+func (e *RPCError) PasswordNeeded() bool {
+	return e.Type == RPC_ERROR_SESSION_PASSWORD_NEEDED
+}
+
+// AsRPCError finds *RPCError in the err chain
+func AsRPCError(err error) (*RPCError, bool) {
+	var e *RPCError
+	if errors.As(err, &e) {
+		return e, true
+	}
+	return nil, false
+}
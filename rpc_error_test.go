@@ -0,0 +1,43 @@
+package mtproto
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNewRPCError(t *testing.T) {
+	cases := []struct {
+		code     int32
+		message  string
+		typ      string
+		argument int32
+	}{
+		{420, "FLOOD_WAIT_30", RPC_ERROR_FLOOD_WAIT, 30},
+		{303, "PHONE_MIGRATE_5", RPC_ERROR_PHONE_MIGRATE, 5},
+		{303, "FILE_MIGRATE_4", RPC_ERROR_FILE_MIGRATE, 4},
+		{401, "SESSION_PASSWORD_NEEDED", RPC_ERROR_SESSION_PASSWORD_NEEDED, 0},
+		{400, "PEER_ID_INVALID", "PEER_ID_INVALID", 0},
+	}
+	for _, c := range cases {
+		e := NewRPCError(c.code, c.message)
+		if e.Code != c.code || e.Type != c.typ || e.Argument != c.argument {
+			t.Errorf("NewRPCError(%d, %s) = %+v", c.code, c.message, e)
+		}
+	}
+
+	if d, ok := NewRPCError(420, "FLOOD_WAIT_30").FloodWait(); !ok || d != 30*time.Second {
+		t.Errorf("FloodWait = %v, %v", d, ok)
+	}
+	if dc, ok := NewRPCError(303, "USER_MIGRATE_2").MigrateDC(); !ok || dc != 2 {
+		t.Errorf("MigrateDC = %v, %v", dc, ok)
+	}
+	if !NewRPCError(401, "SESSION_PASSWORD_NEEDED").PasswordNeeded() {
+		t.Error("PasswordNeeded = false")
+	}
+
+	err := fmt.Errorf("wrapped: %w", NewRPCError(420, "FLOOD_WAIT_7"))
+	if e, ok := AsRPCError(err); !ok || e.Argument != 7 {
+		t.Errorf("AsRPCError(%v) = %v, %v", err, e, ok)
+	}
+}
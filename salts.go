@@ -0,0 +1,127 @@
+package mtproto
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// futureSaltsNum is how many salts get_future_salts asks for, the server sends up to 64
+	futureSaltsNum = 32
+	// futureSaltsRenewBefore is how long before the last known salt expires new ones are asked for
+	futureSaltsRenewBefore = time.Hour
+)
+
+// salt returns the server salt for a message made now: the future salt valid at the server time
+// or the last salt the server sent
+func (m *MTProto) salt() []byte {
+	m.saltMutex.Lock()
+	defer m.saltMutex.Unlock()
+	now := int32(m.serverTime().Unix())
+	for len(m.salts) > 0 && m.salts[0].ValidUntil <= now {
+		m.salts = m.salts[1:]
+	}
+	if len(m.salts) > 0 && m.salts[0].ValidSince <= now {
+		return m.salts[0].Salt
+	}
+	return m.serverSalt
+}
+
+// setSalt uses the salt sent by the server, the future salts stay
+func (m *MTProto) setSalt(salt []byte) {
+	m.saltMutex.Lock()
+	m.serverSalt = salt
+	m.saltMutex.Unlock()
+}
+
+// resetSalts uses salt and forgets the future salts, e.g. for a new auth key or after bad_server_salt
+func (m *MTProto) resetSalts(salt []byte) {
+	m.saltMutex.Lock()
+	m.serverSalt = salt
+	m.salts = nil
+	m.saltMutex.Unlock()
+}
+
+// setFutureSalts keeps the salts of future_salts ordered by time
+func (m *MTProto) setFutureSalts(data TL_future_salts) {
+	salts := make([]FutureSalt, 0, len(data.salts))
+	for _, v := range data.salts {
+		salts = append(salts, FutureSalt{v.valid_since, v.valid_until, v.salt})
+	}
+	sort.Slice(salts, func(i, j int) bool { return salts[i].ValidSince < salts[j].ValidSince })
+	m.saltMutex.Lock()
+	m.salts = salts
+	m.saltMutex.Unlock()
+}
+
+// futureSaltsNeeded reports whether the known salts expire within futureSaltsRenewBefore
+func (m *MTProto) futureSaltsNeeded() bool {
+	m.saltMutex.Lock()
+	defer m.saltMutex.Unlock()
+	if len(m.salts) == 0 {
+		return true
+	}
+	last := time.Unix(int64(m.salts[len(m.salts)-1].ValidUntil), 0)
+	return last.Sub(m.serverTime()) < futureSaltsRenewBefore
+}
+
+// updateFutureSalts asks for future salts and saves them in the session, see checkFutureSalts
+// It gives up when stop is closed
+func (m *MTProto) updateFutureSalts(stop <-chan struct{}) error {
+	resp := make(chan TL, 1)
+	select {
+	case m.queueSend <- packetToSend{TL_get_future_salts{futureSaltsNum}, resp}:
+	case <-stop:
+		return nil
+	}
+
+	select {
+	case x := <-resp:
+		salts, ok := x.(TL_future_salts)
+		if !ok {
+			return fmt.Errorf("get_future_salts: %#v", x)
+		}
+		m.setFutureSalts(salts)
+		return m.saveData()
+	case <-time.After(DefaultRequestTimeout):
+		m.forget(resp)
+		return errors.New("get_future_salts: timeout")
+	case <-stop:
+		m.forget(resp)
+		return nil
+	}
+}
+
+// futureSaltsResult passes future_salts to get_future_salts, the server sends it without rpc_result
+func (m *MTProto) futureSaltsResult(data TL_future_salts) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if v, ok := m.msgsIdToResp[data.req_msg_id]; ok {
+		v.resp <- data
+		close(v.resp)
+		delete(m.msgsIdToResp, data.req_msg_id)
+	}
+	delete(m.msgsIdToAck, data.req_msg_id)
+}
+
+// checkFutureSalts renews the future salts when they run out, CDN DCs are not asked
+// The request runs in its own goroutine, so the pings go on while it waits, one request at a time
+func (m *MTProto) checkFutureSalts() {
+	if m.cdn || !m.futureSaltsNeeded() {
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&m.saltsUpdate, 0, 1) {
+		return
+	}
+	go func(stop <-chan struct{}) {
+		defer atomic.StoreInt32(&m.saltsUpdate, 0)
+		err := m.updateFutureSalts(stop)
+		if err != nil {
+			log.Println("FutureSalts:", err)
+		}
+	}(m.stopPing)
+}
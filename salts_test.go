@@ -0,0 +1,92 @@
+package mtproto
+
+import (
+	"bytes"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFutureSalts(t *testing.T) {
+	m := newServiceTestMTProto()
+	m.serverSalt = []byte{9, 9, 9, 9, 9, 9, 9, 9}
+	if !m.futureSaltsNeeded() {
+		t.Error("no future salts, but they are not needed")
+	}
+
+	now := int32(time.Now().Unix())
+	x := NewEncodeBuf(128)
+	x.UInt(crc_future_salts)
+	x.Long(100)
+	x.Int(now)
+	x.Int(3)
+	// unordered, the first one is expired
+	for _, v := range []TL_future_salt{
+		{now + 1800, now + 3*3600, []byte{3, 3, 3, 3, 3, 3, 3, 3}},
+		{now - 3600, now - 1800, []byte{1, 1, 1, 1, 1, 1, 1, 1}},
+		{now - 1800, now + 1800, []byte{2, 2, 2, 2, 2, 2, 2, 2}},
+	} {
+		x.Int(v.valid_since)
+		x.Int(v.valid_until)
+		x.Bytes(v.salt)
+	}
+	d := NewDecodeBuf(x.buf)
+	data := d.Object()
+	if d.err != nil {
+		t.Fatal(d.err)
+	}
+
+	// future_salts comes without rpc_result
+	resp := make(chan TL, 1)
+	m.msgsIdToResp[100] = packetToSend{TL_get_future_salts{futureSaltsNum}, resp}
+	m.process(201, 1, data)
+	salts, ok := (<-resp).(TL_future_salts)
+	if !ok || salts.now != now || len(salts.salts) != 3 {
+		t.Fatalf("got %#v", salts)
+	}
+	m.setFutureSalts(salts)
+
+	if salt := m.salt(); !bytes.Equal(salt, []byte{2, 2, 2, 2, 2, 2, 2, 2}) {
+		t.Errorf("salt %v", salt)
+	}
+	if m.futureSaltsNeeded() {
+		t.Error("future salts are needed for the next 3 hours")
+	}
+	m.timeOffset = int64(time.Hour)
+	if salt := m.salt(); !bytes.Equal(salt, []byte{3, 3, 3, 3, 3, 3, 3, 3}) {
+		t.Errorf("salt %v an hour later", salt)
+	}
+	m.timeOffset = int64(4 * time.Hour)
+	if salt := m.salt(); !bytes.Equal(salt, m.serverSalt) || !m.futureSaltsNeeded() {
+		t.Errorf("salt %v after the future salts expired", salt)
+	}
+}
+
+func TestCheckFutureSalts(t *testing.T) {
+	m := newServiceTestMTProto()
+	m.stopPing = make(chan struct{})
+	// the second check does not wait for the answer and does not ask again
+	m.checkFutureSalts()
+	m.checkFutureSalts()
+	select {
+	case x := <-m.queueSend:
+		if _, ok := x.msg.(TL_get_future_salts); !ok {
+			t.Errorf("sent %#v", x.msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("get_future_salts is not sent")
+	}
+	select {
+	case x := <-m.queueSend:
+		t.Errorf("sent again %#v", x.msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(m.stopPing)
+	for i := 0; atomic.LoadInt32(&m.saltsUpdate) != 0; i++ {
+		if i == 100 {
+			t.Fatal("get_future_salts is still waiting after the stop")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
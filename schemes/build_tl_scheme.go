@@ -220,9 +220,15 @@ func main() {
 		for _, t := range c.params {
 			t.name = strings.Title(t.name)
 			if strings.HasPrefix(t._type, "flags") {
+				flagBit, _ := strconv.Atoi(string(t._type[strings.Index(t._type, "_") + 1:strings.Index(t._type, "?")]))
 				subType := string(t._type[strings.Index(t._type, "?") + 1:])
+				if subType == "true" {
+					// the bit of flags is the value
+					continue
+				}
+				// optional fields are written only with their bit set
+				fmt.Printf("if e.Flags&(1<<%d) != 0 {\n", flagBit)
 				switch subType {
-				case "true":
 				case "int":
 					fmt.Printf("x.Int(e.%s)\n", t.name)
 				case "long":
@@ -252,6 +258,7 @@ func main() {
 						fmt.Printf("x.Bytes(e.%s.encode())\n", t.name)
 					}
 				}
+				fmt.Print("}\n")
 			} else {
 				switch t._type {
 				case "int", "#":
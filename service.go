@@ -0,0 +1,242 @@
+package mtproto
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// msgs_state_info states, the first three mean the message is not received
+const (
+	msgStateUnknown     = 1
+	msgStateNotReceived = 2
+	msgStateTooHigh     = 3
+	msgStateReceived    = 4
+	msgStateAcked       = 8
+	msgStateNoAck       = 16
+)
+
+const (
+	// maxReceivedMsgs is how many incoming msg_ids are kept to answer msgs_state_req
+	maxReceivedMsgs = 1024
+	// stateReqTimeout is how long a request may wait for an ack before msgs_state_req asks about it
+	stateReqTimeout = time.Minute
+	maxStateReqMsgs = 256
+)
+
+// receivedMsgs remembers the last incoming msg_ids with their seq_no
+// It is used by the read routine only
+type receivedMsgs struct {
+	ids   []int64 // ring buffer, next is the oldest
+	next  int
+	seqNo map[int64]int32
+}
+
+func (r *receivedMsgs) add(msgId int64, seqNo int32) {
+	if r.seqNo == nil {
+		r.ids = make([]int64, maxReceivedMsgs)
+		r.seqNo = make(map[int64]int32, maxReceivedMsgs)
+	}
+	if _, ok := r.seqNo[msgId]; ok {
+		return
+	}
+	delete(r.seqNo, r.ids[r.next])
+	r.ids[r.next] = msgId
+	r.seqNo[msgId] = seqNo
+	r.next = (r.next + 1) % maxReceivedMsgs
+}
+
+func (r *receivedMsgs) has(msgId int64) bool {
+	_, ok := r.seqNo[msgId]
+	return ok
+}
+
+// state returns the msgs_state_info byte of an incoming message, now is the server time
+func (r *receivedMsgs) state(msgId int64, now time.Time) byte {
+	if seqNo, ok := r.seqNo[msgId]; ok {
+		if seqNo&1 == 0 {
+			return msgStateReceived | msgStateNoAck
+		}
+		return msgStateReceived | msgStateAcked
+	}
+	if msgId > messageId(now.Add(msgIdMaxAhead)) {
+		return msgStateTooHigh
+	}
+	if len(r.seqNo) == maxReceivedMsgs && msgId < r.ids[r.next] {
+		// older than everything remembered
+		return msgStateUnknown
+	}
+	return msgStateNotReceived
+}
+
+// answerStateReq answers msgs_state_req of the server
+func (m *MTProto) answerStateReq(msgId int64, data TL_msgs_state_req) {
+	now := m.serverTime()
+	info := make([]byte, len(data.msg_ids))
+	for i, id := range data.msg_ids {
+		info[i] = m.received.state(id, now)
+	}
+	m.enqueue(packetToSend{TL_msgs_state_info{msgId, info}, nil})
+}
+
+// applyMsgsState handles msgs_state_info and msgs_all_info about our messages:
+// received messages are acknowledged, lost ones are resent
+func (m *MTProto) applyMsgsState(ids []int64, info []byte) {
+	var lost []int64
+	m.mutex.Lock()
+	for i, id := range ids {
+		if i >= len(info) {
+			break
+		}
+		switch info[i] & 7 {
+		case msgStateUnknown, msgStateNotReceived, msgStateTooHigh:
+			lost = append(lost, id)
+		case msgStateReceived:
+			delete(m.msgsIdToAck, id)
+		}
+	}
+	m.mutex.Unlock()
+	for _, id := range lost {
+		m.resend(id)
+	}
+}
+
+// detailedInfo handles msg_detailed_info and msg_new_detailed_info:
+// an answer that was not received is requested again, a received one is acknowledged
+func (m *MTProto) detailedInfo(answerMsgId int64) {
+	if m.received.has(answerMsgId) {
+		m.ack(answerMsgId)
+		return
+	}
+	m.enqueue(packetToSend{TL_msg_resend_req{[]int64{answerMsgId}}, nil})
+}
+
+// badMsgNotification corrects the cause of bad_msg_notification and resends the rejected message
+// https://core.telegram.org/mtproto/service_messages_about_messages
+func (m *MTProto) badMsgNotification(msgId int64, data TL_crc_bad_msg_notification) {
+	switch data.error_code {
+	case 16, 17:
+		// msg_id too low or too high: the clock is off
+		if m.setServerTime(msgId) {
+			m.resendUnacked()
+			return
+		}
+	case 18, 19, 20:
+		// wrong msg_id bits, a container with a used msg_id or a forgotten message: a new msg_id helps
+	case 32, 33:
+		// msg_seqno too low or too high: the seq_no state is lost, a new session starts
+		// and the messages the server did not acknowledge are sent again in it
+		err := m.newSession()
+		if err != nil {
+			log.Println("bad_msg_notification: new session:", err)
+			return
+		}
+		m.resendUnacked()
+		return
+	case 34, 35:
+		// wrong seqno parity for a content or a service message
+	case 64:
+		// invalid container, its messages are sent again
+	default:
+		log.Printf("bad_msg_notification: msg %d, code %d", data.bad_msg_id, data.error_code)
+		return
+	}
+	if __debug&DEBUG_LEVEL_NETWORK != 0 {
+		log.Printf("bad_msg_notification: msg %d, code %d, resending", data.bad_msg_id, data.error_code)
+	}
+	m.resend(data.bad_msg_id)
+}
+
+// resendUnacked sends the messages of the old session the server did not acknowledge again, see newSession
+// An acknowledged request may have been executed already, its result does not come to the new session,
+// so the caller gets ErrResultLost instead of a second execution
+func (m *MTProto) resendUnacked() {
+	m.mutex.Lock()
+	resend := make([]packetToSend, 0, len(m.msgsIdToAck))
+	for k, v := range m.msgsIdToAck {
+		resend = append(resend, v)
+		delete(m.msgsIdToAck, k)
+		delete(m.msgsIdToResp, k)
+	}
+	for k, v := range m.msgsIdToResp {
+		v.resp <- lostResult{}
+		close(v.resp)
+		delete(m.msgsIdToResp, k)
+	}
+	m.mutex.Unlock()
+
+	for _, v := range resend {
+		m.enqueue(v)
+	}
+}
+
+// trackStateReq remembers the msg_ids asked with msgs_state_req until msgs_state_info comes
+func (m *MTProto) trackStateReq(msgId int64, ids []int64) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.stateReqs == nil {
+		m.stateReqs = make(map[int64][]int64)
+	}
+	old := messageId(m.serverTime().Add(-5 * stateReqTimeout))
+	for k := range m.stateReqs {
+		if k < old {
+			delete(m.stateReqs, k)
+		}
+	}
+	m.stateReqs[msgId] = ids
+}
+
+// stateInfo handles msgs_state_info answering our msgs_state_req
+func (m *MTProto) stateInfo(data TL_msgs_state_info) {
+	m.mutex.Lock()
+	ids, ok := m.stateReqs[data.req_msg_id]
+	delete(m.stateReqs, data.req_msg_id)
+	m.mutex.Unlock()
+	if ok {
+		m.applyMsgsState(ids, data.info)
+	}
+}
+
+// staleMessages returns the messages waiting for an ack longer than stateReqTimeout
+func (m *MTProto) staleMessages() []int64 {
+	old := messageId(m.serverTime().Add(-stateReqTimeout))
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var ids []int64
+	for id := range m.msgsIdToAck {
+		if id < old && len(ids) < maxStateReqMsgs {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// destroySessionResult passes destroy_session_ok or destroy_session_none to the waiting request,
+// the server sends them without rpc_result
+func (m *MTProto) destroySessionResult(sessionId int64, data TL) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for id, v := range m.msgsIdToResp {
+		if req, ok := v.msg.(TL_destroy_session); ok && req.session_id == sessionId {
+			v.resp <- data
+			close(v.resp)
+			delete(m.msgsIdToResp, id)
+			delete(m.msgsIdToAck, id)
+			return
+		}
+	}
+}
+
+// DestroySession asks the server to forget another session of the auth key, e.g. one of a previous run
+func (m *MTProto) DestroySession(ctx context.Context, sessionID int64) error {
+	x, err := m.Invoke(ctx, TL_destroy_session{sessionID})
+	if err != nil {
+		return err
+	}
+	switch x.(type) {
+	case TL_destroy_session_ok, TL_destroy_session_none:
+		return nil
+	}
+	return fmt.Errorf("RPC: %#v", x)
+}
@@ -0,0 +1,147 @@
+package mtproto
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newServiceTestMTProto() *MTProto {
+	return &MTProto{
+		queueSend:    make(chan packetToSend, 16),
+		stopRead:     make(chan struct{}),
+		mutex:        &sync.Mutex{},
+		msgsIdToAck:  make(map[int64]packetToSend),
+		msgsIdToResp: make(map[int64]packetToSend),
+	}
+}
+
+// queued returns the messages put to the send queue
+func queued(m *MTProto) []TL {
+	var msgs []TL
+	for {
+		select {
+		case x := <-m.queueSend:
+			msgs = append(msgs, x.msg)
+		default:
+			return msgs
+		}
+	}
+}
+
+func TestMsgsStateReq(t *testing.T) {
+	m := newServiceTestMTProto()
+	now := messageId(time.Now())
+	m.process(now-8, 1, TL_pong{})
+	m.process(now-4, 2, TL_pong{})
+	_ = queued(m)
+
+	future := messageId(time.Now().Add(time.Hour))
+	m.process(now, 2, TL_msgs_state_req{[]int64{now - 8, now - 4, now - 12, future}})
+	msgs := queued(m)
+	if len(msgs) != 1 {
+		t.Fatalf("got %#v", msgs)
+	}
+	info, ok := msgs[0].(TL_msgs_state_info)
+	if !ok || info.req_msg_id != now {
+		t.Fatalf("got %#v", msgs[0])
+	}
+	want := []byte{
+		msgStateReceived | msgStateAcked,
+		msgStateReceived | msgStateNoAck,
+		msgStateNotReceived,
+		msgStateTooHigh,
+	}
+	if !bytes.Equal(info.info, want) {
+		t.Errorf("info %v, want %v", info.info, want)
+	}
+}
+
+func TestMsgsStateInfo(t *testing.T) {
+	m := newServiceTestMTProto()
+	m.msgsIdToAck[100] = packetToSend{TL_help_getConfig{}, nil}
+	m.msgsIdToAck[104] = packetToSend{TL_help_getNearestDc{}, nil}
+	m.trackStateReq(200, []int64{100, 104})
+
+	m.process(300, 2, TL_msgs_state_info{200, []byte{msgStateNotReceived, msgStateReceived | msgStateAcked}})
+	msgs := queued(m)
+	if len(msgs) != 1 || msgs[0] != (TL_help_getConfig{}) {
+		t.Errorf("resent %#v", msgs)
+	}
+	if len(m.msgsIdToAck) != 0 {
+		t.Errorf("still waiting for acks: %v", m.msgsIdToAck)
+	}
+	if len(m.stateReqs) != 0 {
+		t.Error("msgs_state_req is not forgotten")
+	}
+
+	m.msgsIdToAck[400] = packetToSend{TL_help_getConfig{}, nil}
+	m.process(500, 2, TL_msg_resend_req{[]int64{400}})
+	if msgs = queued(m); len(msgs) != 1 {
+		t.Errorf("resent %#v", msgs)
+	}
+}
+
+func TestMsgDetailedInfo(t *testing.T) {
+	m := newServiceTestMTProto()
+	m.msgsIdToAck[100] = packetToSend{TL_help_getConfig{}, nil}
+	m.process(201, 1, TL_pong{})
+	_ = queued(m)
+
+	_ = m.pendingAcks()
+	m.process(301, 2, TL_msg_detailed_info{100, 201, 16, 0})
+	if acks := m.pendingAcks(); len(acks) != 1 || acks[0] != 201 {
+		t.Errorf("acks %v", acks)
+	}
+	if len(m.msgsIdToAck) != 0 {
+		t.Error("request is not acknowledged")
+	}
+
+	m.process(401, 2, TL_msg_new_detailed_info{205, 16, 0})
+	msgs := queued(m)
+	if len(msgs) != 1 || msgs[0].(TL_msg_resend_req).msg_ids[0] != 205 {
+		t.Errorf("got %#v", msgs)
+	}
+}
+
+func TestBadMsgSeqNo(t *testing.T) {
+	for _, code := range []int32{32, 33} {
+		m := newServiceTestMTProto()
+		m.sessionId = 7
+		m.lastSeqNo = 10
+		unacked := make(chan TL, 1)
+		m.msgsIdToAck[100] = packetToSend{TL_help_getConfig{}, unacked}
+		m.msgsIdToResp[100] = packetToSend{TL_help_getConfig{}, unacked}
+		// a request acknowledged before, it may have been executed and its result would come to the old session
+		acked := make(chan TL, 1)
+		m.msgsIdToResp[104] = packetToSend{TL_messages_sendMessage{}, acked}
+		m.process(201, 2, TL_crc_bad_msg_notification{100, 9, code})
+		if m.sessionId == 7 || m.lastSeqNo != 0 {
+			t.Errorf("code %d: session %d, seq_no %d", code, m.sessionId, m.lastSeqNo)
+		}
+		if msgs := queued(m); len(msgs) != 1 || msgs[0] != (TL_help_getConfig{}) {
+			t.Errorf("code %d: resent %#v", code, msgs)
+		}
+		if x := <-acked; x != (lostResult{}) {
+			t.Errorf("code %d: acknowledged request got %#v", code, x)
+		}
+		if len(m.msgsIdToResp) != 0 {
+			t.Errorf("code %d: still waiting %v", code, m.msgsIdToResp)
+		}
+	}
+}
+
+func TestDestroySessionResult(t *testing.T) {
+	m := newServiceTestMTProto()
+	resp := make(chan TL, 1)
+	m.msgsIdToAck[100] = packetToSend{TL_destroy_session{7}, resp}
+	m.msgsIdToResp[100] = packetToSend{TL_destroy_session{7}, resp}
+	m.process(201, 2, TL_destroy_session_none{7})
+	if x := <-resp; x != (TL_destroy_session_none{7}) {
+		t.Errorf("got %#v", x)
+	}
+	if len(m.msgsIdToResp) != 0 {
+		t.Error("request is still waiting")
+	}
+}
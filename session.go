@@ -0,0 +1,343 @@
+package mtproto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	crc_session    = 0x5e55104e
+	sessionVersion = 4
+)
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// Session is the persistent state of an authorized connection
+type Session struct {
+	AuthKey     []byte
+	AuthKeyHash []byte
+	ServerSalt  []byte
+	Addr        string
+	DcID        int32
+	Layer       int32
+	DcList      map[int32]string
+	DcKeys      map[int32][]byte
+	Salts       []FutureSalt
+	TestServers bool
+}
+
+// FutureSalt is a server salt valid from ValidSince to ValidUntil, unix time of the server
+type FutureSalt struct {
+	ValidSince int32
+	ValidUntil int32
+	Salt       []byte
+}
+
+// SessionStorage keeps a Session between runs
+//
+//	Load returns ErrSessionNotFound if nothing was saved yet
+type SessionStorage interface {
+	Load() (*Session, error)
+	Save(s *Session) error
+	Delete() error
+}
+
+// Encode serializes the session in the versioned format:
+//
+//	session#5e55104e version:int auth_key:bytes auth_key_hash:bytes server_salt:bytes
+//		addr:string dc_id:int layer:int dclist:vector<int, string>
+//		dc_keys:vector<int, bytes> (version 2)
+//		salts:vector<valid_since:int valid_until:int salt:bytes> (version 3)
+//		test_servers:int (version 4)
+func (s *Session) Encode() []byte {
+	x := NewEncodeBuf(1024)
+	x.UInt(crc_session)
+	x.Int(sessionVersion)
+	x.StringBytes(s.AuthKey)
+	x.StringBytes(s.AuthKeyHash)
+	x.StringBytes(s.ServerSalt)
+	x.String(s.Addr)
+	x.Int(s.DcID)
+	x.Int(s.Layer)
+	x.Int(int32(len(s.DcList)))
+	for id, addr := range s.DcList {
+		x.Int(id)
+		x.String(addr)
+	}
+	x.Int(int32(len(s.DcKeys)))
+	for id, key := range s.DcKeys {
+		x.Int(id)
+		x.StringBytes(key)
+	}
+	x.Int(int32(len(s.Salts)))
+	for _, salt := range s.Salts {
+		x.Int(salt.ValidSince)
+		x.Int(salt.ValidUntil)
+		x.StringBytes(salt.Salt)
+	}
+	if s.TestServers {
+		x.Int(1)
+	} else {
+		x.Int(0)
+	}
+	return x.buf
+}
+
+// DecodeSession parses data written by Session.Encode
+// It also accepts the unversioned authkey file written by older releases
+func DecodeSession(data []byte) (*Session, error) {
+	if len(data) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	s := new(Session)
+	d := NewDecodeBuf(data)
+	if d.UInt() != crc_session {
+		// legacy: auth_key auth_key_hash server_salt addr
+		d = NewDecodeBuf(data)
+		s.AuthKey = d.StringBytes()
+		s.AuthKeyHash = d.StringBytes()
+		s.ServerSalt = d.StringBytes()
+		s.Addr = d.String()
+		if d.err != nil {
+			return nil, d.err
+		}
+		return s, nil
+	}
+
+	version := d.Int()
+	if version < 1 || version > sessionVersion {
+		return nil, fmt.Errorf("Session: unsupported version %d", version)
+	}
+	s.AuthKey = d.StringBytes()
+	s.AuthKeyHash = d.StringBytes()
+	s.ServerSalt = d.StringBytes()
+	s.Addr = d.String()
+	s.DcID = d.Int()
+	s.Layer = d.Int()
+	size := d.Int()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !fits(d, size, 8) {
+		return nil, errors.New("Session: wrong dclist size")
+	}
+	s.DcList = make(map[int32]string, size)
+	for i := int32(0); i < size; i++ {
+		id := d.Int()
+		addr := d.String()
+		if d.err != nil {
+			return nil, d.err
+		}
+		s.DcList[id] = addr
+	}
+	if version < 2 {
+		return s, nil
+	}
+
+	size = d.Int()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !fits(d, size, 8) {
+		return nil, errors.New("Session: wrong dc_keys size")
+	}
+	s.DcKeys = make(map[int32][]byte, size)
+	for i := int32(0); i < size; i++ {
+		id := d.Int()
+		key := d.StringBytes()
+		if d.err != nil {
+			return nil, d.err
+		}
+		s.DcKeys[id] = key
+	}
+	if version < 3 {
+		return s, nil
+	}
+
+	size = d.Int()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if !fits(d, size, 12) {
+		return nil, errors.New("Session: wrong salts size")
+	}
+	s.Salts = make([]FutureSalt, 0, size)
+	for i := int32(0); i < size; i++ {
+		salt := FutureSalt{d.Int(), d.Int(), d.StringBytes()}
+		if d.err != nil {
+			return nil, d.err
+		}
+		s.Salts = append(s.Salts, salt)
+	}
+	if version < 4 {
+		return s, nil
+	}
+
+	s.TestServers = d.Int() != 0
+	if d.err != nil {
+		return nil, d.err
+	}
+	return s, nil
+}
+
+// fits reports whether size entries of at least min bytes each fit into the rest of d,
+// so a corrupted size does not make a huge allocation
+func fits(d *DecodeBuf, size int32, min int) bool {
+	return size >= 0 && int(size) <= (d.size-d.off)/min
+}
+
+// FileSessionStorage keeps the session in a single file
+type FileSessionStorage struct {
+	path string
+}
+
+func NewFileSessionStorage(path string) *FileSessionStorage {
+	return &FileSessionStorage{path}
+}
+
+func (f *FileSessionStorage) Load() (*Session, error) {
+	data, err := readSessionFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeSession(data)
+}
+
+func (f *FileSessionStorage) Save(s *Session) error {
+	return writeSessionFile(f.path, s.Encode())
+}
+
+func (f *FileSessionStorage) Delete() error {
+	return removeSessionFile(f.path)
+}
+
+// MemorySessionStorage keeps the session in memory only
+type MemorySessionStorage struct {
+	mutex sync.Mutex
+	data  []byte
+}
+
+func NewMemorySessionStorage() *MemorySessionStorage {
+	return &MemorySessionStorage{}
+}
+
+func (s *MemorySessionStorage) Load() (*Session, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return DecodeSession(s.data)
+}
+
+func (s *MemorySessionStorage) Save(session *Session) error {
+	s.mutex.Lock()
+	s.data = session.Encode()
+	s.mutex.Unlock()
+	return nil
+}
+
+func (s *MemorySessionStorage) Delete() error {
+	s.mutex.Lock()
+	s.data = nil
+	s.mutex.Unlock()
+	return nil
+}
+
+// EncryptedFileSessionStorage keeps the session in a file encrypted with AES-256-GCM
+// The AES key is SHA-256 of the given key
+type EncryptedFileSessionStorage struct {
+	path string
+	aead cipher.AEAD
+}
+
+func NewEncryptedFileSessionStorage(path string, key []byte) (*EncryptedFileSessionStorage, error) {
+	if len(key) == 0 {
+		return nil, errors.New("Session: empty encryption key")
+	}
+	k := sha256.Sum256(key)
+	block, err := aes.NewCipher(k[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedFileSessionStorage{path, aead}, nil
+}
+
+func (f *EncryptedFileSessionStorage) Load() (*Session, error) {
+	data, err := readSessionFile(f.path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, ErrSessionNotFound
+	}
+	size := f.aead.NonceSize()
+	if len(data) < size {
+		return nil, errors.New("Session: encrypted data too short")
+	}
+	plain, err := f.aead.Open(nil, data[:size], data[size:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("Session: decrypt: %s", err)
+	}
+	return DecodeSession(plain)
+}
+
+func (f *EncryptedFileSessionStorage) Save(s *Session) error {
+	nonce := make([]byte, f.aead.NonceSize())
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	return writeSessionFile(f.path, f.aead.Seal(nonce, nonce, s.Encode(), nil))
+}
+
+func (f *EncryptedFileSessionStorage) Delete() error {
+	return removeSessionFile(f.path)
+}
+
+func readSessionFile(path string) ([]byte, error) {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, ErrSessionNotFound
+	}
+	return data, err
+}
+
+// writeSessionFile replaces the file atomically so a crash never leaves a truncated session
+func writeSessionFile(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(0600)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func removeSessionFile(path string) error {
+	err := os.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+package mtproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func testSession() *Session {
+	return &Session{
+		AuthKey:     bytes.Repeat([]byte{0xab}, 256),
+		AuthKeyHash: []byte{1, 2, 3, 4, 5, 6, 7, 8},
+		ServerSalt:  []byte{8, 7, 6, 5, 4, 3, 2, 1},
+		Addr:        "149.154.167.91:443",
+		DcID:        2,
+		Layer:       layer,
+		DcList:      map[int32]string{1: "149.154.175.50:443", 2: "149.154.167.51:443"},
+		DcKeys:      map[int32][]byte{4: bytes.Repeat([]byte{0xcd}, 256)},
+		Salts:       []FutureSalt{{1500000000, 1500003600, []byte{1, 1, 1, 1, 1, 1, 1, 1}}},
+	}
+}
+
+func TestSessionStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mtproto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"file":      filepath.Join(dir, "plain"),
+		"encrypted": filepath.Join(dir, "encrypted"),
+	}
+	encrypted, err := NewEncryptedFileSessionStorage(files["encrypted"], []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]SessionStorage{
+		"file":      NewFileSessionStorage(files["file"]),
+		"memory":    NewMemorySessionStorage(),
+		"encrypted": encrypted,
+	}
+
+	for name, storage := range cases {
+		if _, err := storage.Load(); err != ErrSessionNotFound {
+			t.Errorf("%s: Load on empty storage: %v, want ErrSessionNotFound", name, err)
+		}
+		want := testSession()
+		if err := storage.Save(want); err != nil {
+			t.Fatalf("%s: Save: %s", name, err)
+		}
+		got, err := storage.Load()
+		if err != nil {
+			t.Fatalf("%s: Load: %s", name, err)
+		}
+		if !bytes.Equal(got.AuthKey, want.AuthKey) || got.Addr != want.Addr || got.DcID != want.DcID ||
+			got.Layer != want.Layer || len(got.DcList) != 2 || got.DcList[1] != want.DcList[1] ||
+			!bytes.Equal(got.DcKeys[4], want.DcKeys[4]) || len(got.Salts) != 1 ||
+			got.Salts[0].ValidUntil != want.Salts[0].ValidUntil || !bytes.Equal(got.Salts[0].Salt, want.Salts[0].Salt) {
+			t.Errorf("%s: session mismatch: %+v", name, got)
+		}
+		if path, ok := files[name]; ok {
+			// the plain file shows the check works, the encrypted one must not contain the session
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			leaks := bytes.Contains(data, []byte(want.Addr)) || bytes.Contains(data, want.AuthKey)
+			if leaks != (name == "file") {
+				t.Errorf("%s: file contains the plaintext session: %v", name, leaks)
+			}
+		}
+		if err := storage.Delete(); err != nil {
+			t.Errorf("%s: Delete: %s", name, err)
+		}
+		if _, err := storage.Load(); err != ErrSessionNotFound {
+			t.Errorf("%s: Load after Delete: %v, want ErrSessionNotFound", name, err)
+		}
+	}
+}
+
+func TestDecodeLegacySession(t *testing.T) {
+	want := testSession()
+	b := NewEncodeBuf(512)
+	b.StringBytes(want.AuthKey)
+	b.StringBytes(want.AuthKeyHash)
+	b.StringBytes(want.ServerSalt)
+	b.String(want.Addr)
+
+	got, err := DecodeSession(b.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.AuthKey, want.AuthKey) || !bytes.Equal(got.ServerSalt, want.ServerSalt) || got.Addr != want.Addr {
+		t.Errorf("legacy session mismatch: %+v", got)
+	}
+}
+
+func TestDecodeSessionLayout(t *testing.T) {
+	// the layout of version 4 written by hand, layer follows dc_id
+	b := NewEncodeBuf(512)
+	b.UInt(crc_session)
+	b.Int(4)
+	b.StringBytes(bytes.Repeat([]byte{0xab}, 256))
+	b.StringBytes([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+	b.StringBytes(make([]byte, 8))
+	b.String("149.154.167.91:443")
+	b.Int(2)
+	b.Int(layer)
+	b.Int(1)
+	b.Int(1)
+	b.String("149.154.175.50:443")
+	b.Int(0)
+	b.Int(0)
+	b.Int(1)
+	got, err := DecodeSession(b.buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DcID != 2 || got.Layer != layer || got.DcList[1] != "149.154.175.50:443" || !got.TestServers {
+		t.Errorf("session mismatch: %+v", got)
+	}
+}
+
+func TestDecodeSessionSize(t *testing.T) {
+	data := testSession().Encode()
+	// dclist size follows auth_key, auth_key_hash, server_salt, addr, dc_id and layer
+	d := NewDecodeBuf(data)
+	d.UInt()
+	d.Int()
+	d.StringBytes()
+	d.StringBytes()
+	d.StringBytes()
+	_ = d.String()
+	d.Int()
+	d.Int()
+	binary.LittleEndian.PutUint32(data[d.off:], 0x7fffffff)
+	if _, err := DecodeSession(data); err == nil {
+		t.Error("huge dclist size accepted")
+	}
+}
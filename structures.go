@@ -128,6 +128,7 @@ func (d *Document) GetInputFileLocation() TL_inputDocumentFileLocation {
 	return TL_inputDocumentFileLocation{
 		Id:          d.ID,
 		Access_hash: d.AccessHash,
+		Version:     d.Version,
 	}
 }
 
@@ -31,6 +31,26 @@ type TL_p_q_inner_data struct {
 	server_nonce []byte
 	new_nonce    []byte
 }
+
+// TL_p_q_inner_data_temp asks for a temporary auth key living expires_in seconds
+type TL_p_q_inner_data_temp struct {
+	pq           *big.Int
+	p            *big.Int
+	q            *big.Int
+	nonce        []byte
+	server_nonce []byte
+	new_nonce    []byte
+	expires_in   int32
+}
+
+type TL_bind_auth_key_inner struct {
+	nonce            int64
+	temp_auth_key_id int64
+	perm_auth_key_id int64
+	temp_session_id  int64
+	expires_at       int32
+}
+
 type TL_req_DH_params struct {
 	nonce        []byte
 	server_nonce []byte
@@ -63,6 +83,12 @@ type TL_server_DH_params_ok struct {
 	encrypted_answer []byte
 }
 
+type TL_server_DH_params_fail struct {
+	nonce          []byte
+	server_nonce   []byte
+	new_nonce_hash []byte
+}
+
 type TL_server_DH_inner_data struct {
 	nonce        []byte
 	server_nonce []byte
@@ -95,11 +121,75 @@ type TL_msgs_ack struct {
 	msgIds []int64
 }
 
+type TL_msgs_state_req struct {
+	msg_ids []int64
+}
+
+// TL_msgs_state_info answers msgs_state_req, info has a state byte per requested message
+type TL_msgs_state_info struct {
+	req_msg_id int64
+	info       []byte
+}
+
+type TL_msgs_all_info struct {
+	msg_ids []int64
+	info    []byte
+}
+
+type TL_msg_detailed_info struct {
+	msg_id        int64
+	answer_msg_id int64
+	bytes         int32
+	status        int32
+}
+
+type TL_msg_new_detailed_info struct {
+	answer_msg_id int64
+	bytes         int32
+	status        int32
+}
+
+type TL_msg_resend_req struct {
+	msg_ids []int64
+}
+
+type TL_get_future_salts struct {
+	num int32
+}
+
+type TL_future_salt struct {
+	valid_since int32
+	valid_until int32
+	salt        []byte
+}
+
+// TL_future_salts answers get_future_salts without rpc_result
+type TL_future_salts struct {
+	req_msg_id int64
+	now        int32
+	salts      []TL_future_salt
+}
+
+type TL_destroy_session struct {
+	session_id int64
+}
+
+type TL_destroy_session_ok struct {
+	session_id int64
+}
+
+type TL_destroy_session_none struct {
+	session_id int64
+}
+
 type TL_rpc_result struct {
 	req_msg_id int64
 	obj        interface{}
 }
 
+// VectorObject is a Vector of objects returned as rpc_result
+type VectorObject []TL
+
 type TL_rpc_error struct {
 	error_code    int32
 	error_message string
@@ -111,6 +201,18 @@ type TL_dh_gen_ok struct {
 	new_nonce_hash1 []byte
 }
 
+type TL_dh_gen_retry struct {
+	nonce           []byte
+	server_nonce    []byte
+	new_nonce_hash2 []byte
+}
+
+type TL_dh_gen_fail struct {
+	nonce           []byte
+	server_nonce    []byte
+	new_nonce_hash3 []byte
+}
+
 type TL_ping struct {
 	ping_id int64
 }
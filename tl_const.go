@@ -7,6 +7,8 @@ const (
 	crc_vector                     = 0x1cb5c415
 	crc_resPQ                      = 0x05162463
 	crc_p_q_inner_data             = 0x83c95aec
+	crc_p_q_inner_data_temp        = 0x3c6a84d4
+	crc_bind_auth_key_inner        = 0x75a3f765
 	crc_server_DH_params_fail      = 0x79cb045d
 	crc_server_DH_params_ok        = 0xd0e8075c
 	crc_server_DH_inner_data       = 0xb5890dba
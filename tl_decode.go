@@ -7,10 +7,14 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"math"
 	"math/big"
 )
 
+// maxGzipSize limits the unpacked size of gzip_packed
+const maxGzipSize = 64 * 1024 * 1024
+
 type DecodeBuf struct {
 	buf  []byte
 	off  int
@@ -301,6 +305,68 @@ func (m *DecodeBuf) Bool() bool {
 	return false
 }
 
+// ResultObject decodes the body of rpc_result, an object or a Vector of objects
+func (m *DecodeBuf) ResultObject() TL {
+	if m.err == nil && m.off+4 <= m.size && binary.LittleEndian.Uint32(m.buf[m.off:m.off+4]) == crc_vector {
+		return VectorObject(m.Vector())
+	}
+	return m.Object()
+}
+
+// futureSalts decodes future_salts, its salts are a bare vector of bare future_salt
+func (m *DecodeBuf) futureSalts() TL {
+	r := TL_future_salts{req_msg_id: m.Long(), now: m.Int()}
+	size := m.Int()
+	if m.err != nil {
+		return nil
+	}
+	if size < 0 || int(size)*16 > m.size-m.off {
+		m.err = errors.New("DecodeFutureSalts: Wrong size")
+		return nil
+	}
+	r.salts = make([]TL_future_salt, size)
+	for i := range r.salts {
+		r.salts[i] = TL_future_salt{m.Int(), m.Int(), m.Bytes(8)}
+	}
+	return r
+}
+
+// gzipPacked decodes the object packed in gzip_packed, a vector is returned as VectorObject
+func (m *DecodeBuf) gzipPacked() TL {
+	obj, err := gunzip(m.StringBytes())
+	if m.err != nil {
+		return nil
+	}
+	if err != nil {
+		m.err = err
+		return nil
+	}
+	d := NewDecodeBuf(obj)
+	r := d.ResultObject()
+	if d.err != nil {
+		m.err = d.err
+		return nil
+	}
+	return r
+}
+
+// gunzip unpacks up to maxGzipSize bytes
+func gunzip(data []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("gzip_packed: %s", err)
+	}
+	defer gz.Close()
+	obj, err := io.ReadAll(io.LimitReader(gz, maxGzipSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("gzip_packed: %s", err)
+	}
+	if len(obj) > maxGzipSize {
+		return nil, fmt.Errorf("gzip_packed: unpacked size exceeds %d", maxGzipSize)
+	}
+	return obj, nil
+}
+
 func (m *DecodeBuf) Vector() []TL {
 	constructor := m.UInt()
 	if m.err != nil {
@@ -353,6 +419,12 @@ func (m *DecodeBuf) Object() (r TL) {
 		}
 		r = TL_server_DH_params_ok{m.Bytes(16), m.Bytes(16), m.StringBytes()}
 
+	case crc_server_DH_params_fail:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("server_DH_params_fail", constructor)
+		}
+		r = TL_server_DH_params_fail{m.Bytes(16), m.Bytes(16), m.Bytes(16)}
+
 	case crc_server_DH_inner_data:
 		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
 			fmt.Println("server_DH_inner_data", constructor)
@@ -368,6 +440,18 @@ func (m *DecodeBuf) Object() (r TL) {
 		}
 		r = TL_dh_gen_ok{m.Bytes(16), m.Bytes(16), m.Bytes(16)}
 
+	case crc_dh_gen_retry:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("dh_gen_retry", constructor)
+		}
+		r = TL_dh_gen_retry{m.Bytes(16), m.Bytes(16), m.Bytes(16)}
+
+	case crc_dh_gen_fail:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("dh_gen_fail", constructor)
+		}
+		r = TL_dh_gen_fail{m.Bytes(16), m.Bytes(16), m.Bytes(16)}
+
 	case crc_ping:
 		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
 			fmt.Println("ping", constructor)
@@ -400,7 +484,7 @@ func (m *DecodeBuf) Object() (r TL) {
 		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
 			fmt.Println("rpc_result", constructor)
 		}
-		r = TL_rpc_result{m.Long(), m.Object()}
+		r = TL_rpc_result{m.Long(), m.ResultObject()}
 
 	case crc_rpc_error:
 		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
@@ -432,25 +516,65 @@ func (m *DecodeBuf) Object() (r TL) {
 		}
 		r = TL_msgs_ack{m.VectorLong()}
 
+	case crc_msgs_state_req:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("msgs_state_req", constructor)
+		}
+		r = TL_msgs_state_req{m.VectorLong()}
+
+	case crc_msgs_state_info:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("msgs_state_info", constructor)
+		}
+		r = TL_msgs_state_info{m.Long(), m.StringBytes()}
+
+	case crc_msgs_all_info:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("msgs_all_info", constructor)
+		}
+		r = TL_msgs_all_info{m.VectorLong(), m.StringBytes()}
+
+	case crc_msg_detailed_info:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("msg_detailed_info", constructor)
+		}
+		r = TL_msg_detailed_info{m.Long(), m.Long(), m.Int(), m.Int()}
+
+	case crc_msg_new_detailed_info:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("msg_new_detailed_info", constructor)
+		}
+		r = TL_msg_new_detailed_info{m.Long(), m.Int(), m.Int()}
+
+	case crc_msg_resend_req:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("msg_resend_req", constructor)
+		}
+		r = TL_msg_resend_req{m.VectorLong()}
+
+	case crc_destroy_session_ok:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("destroy_session_ok", constructor)
+		}
+		r = TL_destroy_session_ok{m.Long()}
+
+	case crc_destroy_session_none:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("destroy_session_none", constructor)
+		}
+		r = TL_destroy_session_none{m.Long()}
+
+	case crc_future_salts:
+		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
+			fmt.Println("future_salts", constructor)
+		}
+		r = m.futureSalts()
+
 	case crc_gzip_packed:
 		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
 			fmt.Println("gzip_packed", constructor)
 		}
-		obj := make([]byte, 0, 4096)
-
-		var buf bytes.Buffer
-		_, _ = buf.Write(m.StringBytes())
-		gz, _ := gzip.NewReader(&buf)
-		b := make([]byte, 4096)
-		for true {
-			n, _ := gz.Read(b)
-			obj = append(obj, b[0:n]...)
-			if n <= 0 {
-				break
-			}
-		}
-		d := NewDecodeBuf(obj)
-		r = d.Object()
+		r = m.gzipPacked()
 
 	default:
 		if __debug&DEBUG_LEVEL_DECODE_DETAILS != 0 {
@@ -618,6 +742,9 @@ func (m *DecodeBuf) FlaggedObject(flags, f int32) (r TL) {
 	case crc_server_DH_params_ok:
 		r = TL_server_DH_params_ok{m.Bytes(16), m.Bytes(16), m.StringBytes()}
 
+	case crc_server_DH_params_fail:
+		r = TL_server_DH_params_fail{m.Bytes(16), m.Bytes(16), m.Bytes(16)}
+
 	case crc_server_DH_inner_data:
 		r = TL_server_DH_inner_data{
 			m.Bytes(16), m.Bytes(16), m.Int(),
@@ -627,6 +754,12 @@ func (m *DecodeBuf) FlaggedObject(flags, f int32) (r TL) {
 	case crc_dh_gen_ok:
 		r = TL_dh_gen_ok{m.Bytes(16), m.Bytes(16), m.Bytes(16)}
 
+	case crc_dh_gen_retry:
+		r = TL_dh_gen_retry{m.Bytes(16), m.Bytes(16), m.Bytes(16)}
+
+	case crc_dh_gen_fail:
+		r = TL_dh_gen_fail{m.Bytes(16), m.Bytes(16), m.Bytes(16)}
+
 	case crc_ping:
 		r = TL_ping{m.Long()}
 
@@ -647,7 +780,7 @@ func (m *DecodeBuf) FlaggedObject(flags, f int32) (r TL) {
 		r = TL_msg_container{arr}
 
 	case crc_rpc_result:
-		r = TL_rpc_result{m.Long(), m.Object()}
+		r = TL_rpc_result{m.Long(), m.ResultObject()}
 
 	case crc_rpc_error:
 		r = TL_rpc_error{m.Int(), m.String()}
@@ -664,23 +797,35 @@ func (m *DecodeBuf) FlaggedObject(flags, f int32) (r TL) {
 	case crc_msgs_ack:
 		r = TL_msgs_ack{m.VectorLong()}
 
+	case crc_msgs_state_req:
+		r = TL_msgs_state_req{m.VectorLong()}
+
+	case crc_msgs_state_info:
+		r = TL_msgs_state_info{m.Long(), m.StringBytes()}
+
+	case crc_msgs_all_info:
+		r = TL_msgs_all_info{m.VectorLong(), m.StringBytes()}
+
+	case crc_msg_detailed_info:
+		r = TL_msg_detailed_info{m.Long(), m.Long(), m.Int(), m.Int()}
+
+	case crc_msg_new_detailed_info:
+		r = TL_msg_new_detailed_info{m.Long(), m.Int(), m.Int()}
+
+	case crc_msg_resend_req:
+		r = TL_msg_resend_req{m.VectorLong()}
+
+	case crc_destroy_session_ok:
+		r = TL_destroy_session_ok{m.Long()}
+
+	case crc_destroy_session_none:
+		r = TL_destroy_session_none{m.Long()}
+
+	case crc_future_salts:
+		r = m.futureSalts()
+
 	case crc_gzip_packed:
-		obj := make([]byte, 0, 4096)
-
-		var buf bytes.Buffer
-		_, _ = buf.Write(m.StringBytes())
-		gz, _ := gzip.NewReader(&buf)
-
-		b := make([]byte, 4096)
-		for true {
-			n, _ := gz.Read(b)
-			obj = append(obj, b[0:n]...)
-			if n <= 0 {
-				break
-			}
-		}
-		d := NewDecodeBuf(obj)
-		r = d.Object()
+		r = m.gzipPacked()
 
 	default:
 		r = m.ObjectGenerated(constructor)
@@ -0,0 +1,63 @@
+package mtproto
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestGzipPacked(t *testing.T) {
+	contacts := make([]TL, 100)
+	for i := range contacts {
+		contacts[i] = TL_inputPhoneContact{int64(i), fmt.Sprintf("+1555%07d", i), "First", "Last"}
+	}
+	msg := TL_contacts_importContacts{contacts}
+	obj := msg.encode()
+	packed := gzipPacked(obj)
+	if len(packed) >= len(obj) {
+		t.Fatalf("not compressed: %d >= %d", len(packed), len(obj))
+	}
+	d := NewDecodeBuf(packed)
+	if x := d.Object(); d.err != nil || !reflect.DeepEqual(x, msg) {
+		t.Errorf("got %#v, %v", x, d.err)
+	}
+
+	random := make([]byte, 2048)
+	_, _ = rand.Read(random)
+	random = TL_upload_saveFilePart{1, 0, random}.encode()
+	if !bytes.Equal(gzipPacked(random), random) {
+		t.Error("incompressible data is packed")
+	}
+
+	// packed vectors come in rpc_result
+	x := NewEncodeBuf(64)
+	x.UInt(crc_vector)
+	x.Int(1)
+	x.Bytes(TL_inputPeerSelf{}.encode())
+	d = NewDecodeBuf(gzipString(t, x.buf))
+	if v, ok := d.Object().(VectorObject); !ok || len(v) != 1 {
+		t.Errorf("got %#v, %v", v, d.err)
+	}
+
+	d = NewDecodeBuf(gzipString(t, make([]byte, maxGzipSize+4)))
+	if d.Object() != nil || d.err == nil {
+		t.Error("unpacked more than maxGzipSize")
+	}
+}
+
+// gzipString returns gzip_packed data regardless of its size
+func gzipString(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(data)
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	x := NewEncodeBuf(buf.Len() + 8)
+	x.UInt(crc_gzip_packed)
+	x.StringBytes(buf.Bytes())
+	return x.buf
+}
@@ -1,6 +1,8 @@
 package mtproto
 
 import (
+	"bytes"
+	"compress/gzip"
 	"crypto/rand"
 	"encoding/binary"
 	"math"
@@ -14,13 +16,39 @@ func GenerateNonce(size int) []byte {
 	return b
 }
 
+// GenerateMessageId returns a msg_id for the local clock, MTProto uses the server time, see newMsgId
 func GenerateMessageId() int64 {
+	return messageId(time.Now())
+}
+
+func messageId(t time.Time) int64 {
 	const nano = 1000 * 1000 * 1000
-	unixnano := time.Now().UnixNano()
+	unixnano := t.UnixNano()
 
 	return ((unixnano / nano) << 32) | ((unixnano % nano) & -4)
 }
 
+// gzipThreshold is the encoded size from which requests are sent gzip_packed
+const gzipThreshold = 1024
+
+// gzipPacked wraps obj into gzip_packed if that makes it smaller
+func gzipPacked(obj []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(obj)
+	if gz.Close() != nil {
+		return obj
+	}
+	// constructor and string length
+	if buf.Len()+8 >= len(obj) {
+		return obj
+	}
+	x := NewEncodeBuf(buf.Len() + 8)
+	x.UInt(crc_gzip_packed)
+	x.StringBytes(buf.Bytes())
+	return x.buf
+}
+
 type EncodeBuf struct {
 	buf []byte
 }
@@ -124,16 +152,25 @@ func (e *EncodeBuf) Vector(v []TL) {
 	}
 }
 
-func (e TL_msg_container) encode() []byte            { return nil }
 func (e TL_resPQ) encode() []byte                    { return nil }
 func (e TL_server_DH_params_ok) encode() []byte      { return nil }
+func (e TL_server_DH_params_fail) encode() []byte    { return nil }
 func (e TL_server_DH_inner_data) encode() []byte     { return nil }
 func (e TL_dh_gen_ok) encode() []byte                { return nil }
+func (e TL_dh_gen_retry) encode() []byte             { return nil }
+func (e TL_dh_gen_fail) encode() []byte              { return nil }
 func (e TL_rpc_result) encode() []byte               { return nil }
+func (e VectorObject) encode() []byte                { return nil }
 func (e TL_rpc_error) encode() []byte                { return nil }
 func (e TL_new_session_created) encode() []byte      { return nil }
 func (e TL_bad_server_salt) encode() []byte          { return nil }
 func (e TL_crc_bad_msg_notification) encode() []byte { return nil }
+func (e TL_msgs_all_info) encode() []byte            { return nil }
+func (e TL_msg_detailed_info) encode() []byte        { return nil }
+func (e TL_msg_new_detailed_info) encode() []byte    { return nil }
+func (e TL_destroy_session_ok) encode() []byte       { return nil }
+func (e TL_future_salts) encode() []byte             { return nil }
+func (e TL_destroy_session_none) encode() []byte     { return nil }
 
 func (e TL_req_pq) encode() []byte {
 	x := NewEncodeBuf(20)
@@ -154,6 +191,30 @@ func (e TL_p_q_inner_data) encode() []byte {
 	return x.buf
 }
 
+func (e TL_p_q_inner_data_temp) encode() []byte {
+	x := NewEncodeBuf(256)
+	x.UInt(crc_p_q_inner_data_temp)
+	x.BigInt(e.pq)
+	x.BigInt(e.p)
+	x.BigInt(e.q)
+	x.Bytes(e.nonce)
+	x.Bytes(e.server_nonce)
+	x.Bytes(e.new_nonce)
+	x.Int(e.expires_in)
+	return x.buf
+}
+
+func (e TL_bind_auth_key_inner) encode() []byte {
+	x := NewEncodeBuf(40)
+	x.UInt(crc_bind_auth_key_inner)
+	x.Long(e.nonce)
+	x.Long(e.temp_auth_key_id)
+	x.Long(e.perm_auth_key_id)
+	x.Long(e.temp_session_id)
+	x.Int(e.expires_at)
+	return x.buf
+}
+
 func (e TL_req_DH_params) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_req_DH_params)
@@ -200,6 +261,57 @@ func (e TL_pong) encode() []byte {
 	return x.buf
 }
 
+func (e TL_msgs_state_req) encode() []byte {
+	x := NewEncodeBuf(64)
+	x.UInt(crc_msgs_state_req)
+	x.VectorLong(e.msg_ids)
+	return x.buf
+}
+
+func (e TL_msgs_state_info) encode() []byte {
+	x := NewEncodeBuf(64)
+	x.UInt(crc_msgs_state_info)
+	x.Long(e.req_msg_id)
+	x.StringBytes(e.info)
+	return x.buf
+}
+
+func (e TL_msg_resend_req) encode() []byte {
+	x := NewEncodeBuf(64)
+	x.UInt(crc_msg_resend_req)
+	x.VectorLong(e.msg_ids)
+	return x.buf
+}
+
+func (e TL_get_future_salts) encode() []byte {
+	x := NewEncodeBuf(8)
+	x.UInt(crc_get_future_salts)
+	x.Int(e.num)
+	return x.buf
+}
+
+func (e TL_destroy_session) encode() []byte {
+	x := NewEncodeBuf(12)
+	x.UInt(crc_destroy_session)
+	x.Long(e.session_id)
+	return x.buf
+}
+
+// encode is used for outgoing containers only, their items hold encoded messages
+func (e TL_msg_container) encode() []byte {
+	x := NewEncodeBuf(512)
+	x.UInt(crc_msg_container)
+	x.Int(int32(len(e.items)))
+	for _, v := range e.items {
+		body := v.data.([]byte)
+		x.Long(v.msg_id)
+		x.Int(v.seq_no)
+		x.Int(int32(len(body)))
+		x.Bytes(body)
+	}
+	return x.buf
+}
+
 func (e TL_msgs_ack) encode() []byte {
 	x := NewEncodeBuf(64)
 	x.UInt(crc_msgs_ack)
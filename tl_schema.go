@@ -5478,8 +5478,12 @@ func (e TL_inputMediaUploadedPhoto) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e.File.encode())
 	x.String(e.Caption)
-	x.Vector(e.Stickers)
-	x.Int(e.Ttl_seconds)
+	if e.Flags&(1<<0) != 0 {
+		x.Vector(e.Stickers)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Ttl_seconds)
+	}
 	return x.buf
 }
 
@@ -5489,7 +5493,9 @@ func (e TL_inputMediaPhoto) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e.Id.encode())
 	x.String(e.Caption)
-	x.Int(e.Ttl_seconds)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Ttl_seconds)
+	}
 	return x.buf
 }
 
@@ -5722,7 +5728,9 @@ func (e TL_chat) encode() []byte {
 	x.Int(e.Participants_count)
 	x.Int(e.Date)
 	x.Int(e.Version)
-	x.Bytes(e.Migrated_to.encode())
+	if e.Flags&(1<<6) != 0 {
+		x.Bytes(e.Migrated_to.encode())
+	}
 	return x.buf
 }
 
@@ -5760,7 +5768,9 @@ func (e TL_chatParticipantsForbidden) encode() []byte {
 	x.UInt(crc_chatParticipantsForbidden)
 	x.Int(e.Flags)
 	x.Int(e.Chat_id)
-	x.Bytes(e.Self_participant.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Self_participant.encode())
+	}
 	return x.buf
 }
 
@@ -5799,19 +5809,39 @@ func (e TL_message) encode() []byte {
 	x.UInt(crc_message)
 	x.Int(e.Flags)
 	x.Int(e.Id)
-	x.Int(e.From_id)
+	if e.Flags&(1<<8) != 0 {
+		x.Int(e.From_id)
+	}
 	x.Bytes(e.To_id.encode())
-	x.Bytes(e.Fwd_from.encode())
-	x.Int(e.Via_bot_id)
-	x.Int(e.Reply_to_msg_id)
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Fwd_from.encode())
+	}
+	if e.Flags&(1<<11) != 0 {
+		x.Int(e.Via_bot_id)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.Int(e.Reply_to_msg_id)
+	}
 	x.Int(e.Date)
 	x.String(e.Message)
-	x.Bytes(e.Media.encode())
-	x.Bytes(e.Reply_markup.encode())
-	x.Vector(e.Entities)
-	x.Int(e.Views)
-	x.Int(e.Edit_date)
-	x.String(e.Post_author)
+	if e.Flags&(1<<9) != 0 {
+		x.Bytes(e.Media.encode())
+	}
+	if e.Flags&(1<<6) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
+	if e.Flags&(1<<7) != 0 {
+		x.Vector(e.Entities)
+	}
+	if e.Flags&(1<<10) != 0 {
+		x.Int(e.Views)
+	}
+	if e.Flags&(1<<15) != 0 {
+		x.Int(e.Edit_date)
+	}
+	if e.Flags&(1<<16) != 0 {
+		x.String(e.Post_author)
+	}
 	return x.buf
 }
 
@@ -5820,9 +5850,13 @@ func (e TL_messageService) encode() []byte {
 	x.UInt(crc_messageService)
 	x.Int(e.Flags)
 	x.Int(e.Id)
-	x.Int(e.From_id)
+	if e.Flags&(1<<8) != 0 {
+		x.Int(e.From_id)
+	}
 	x.Bytes(e.To_id.encode())
-	x.Int(e.Reply_to_msg_id)
+	if e.Flags&(1<<3) != 0 {
+		x.Int(e.Reply_to_msg_id)
+	}
 	x.Int(e.Date)
 	x.Bytes(e.Action.encode())
 	return x.buf
@@ -5838,9 +5872,15 @@ func (e TL_messageMediaPhoto) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_messageMediaPhoto)
 	x.Int(e.Flags)
-	x.Bytes(e.Photo.encode())
-	x.String(e.Caption)
-	x.Int(e.Ttl_seconds)
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Photo.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Caption)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Int(e.Ttl_seconds)
+	}
 	return x.buf
 }
 
@@ -5926,8 +5966,12 @@ func (e TL_dialog) encode() []byte {
 	x.Int(e.Unread_count)
 	x.Int(e.Unread_mentions_count)
 	x.Bytes(e.Notify_settings.encode())
-	x.Int(e.Pts)
-	x.Bytes(e.Draft.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Pts)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Bytes(e.Draft.encode())
+	}
 	return x.buf
 }
 
@@ -6005,8 +6049,12 @@ func (e TL_auth_sentCode) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e._Type.encode())
 	x.String(e.Phone_code_hash)
-	x.Bytes(e.Next_type.encode())
-	x.Int(e.Timeout)
+	if e.Flags&(1<<1) != 0 {
+		x.Bytes(e.Next_type.encode())
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Int(e.Timeout)
+	}
 	return x.buf
 }
 
@@ -6014,7 +6062,9 @@ func (e TL_auth_authorization) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_auth_authorization)
 	x.Int(e.Flags)
-	x.Int(e.Tmp_sessions)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Tmp_sessions)
+	}
 	x.Bytes(e.User.encode())
 	return x.buf
 }
@@ -6103,11 +6153,17 @@ func (e TL_userFull) encode() []byte {
 	x.UInt(crc_userFull)
 	x.Int(e.Flags)
 	x.Bytes(e.User.encode())
-	x.String(e.About)
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.About)
+	}
 	x.Bytes(e.Link.encode())
-	x.Bytes(e.Profile_photo.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Profile_photo.encode())
+	}
 	x.Bytes(e.Notify_settings.encode())
-	x.Bytes(e.Bot_info.encode())
+	if e.Flags&(1<<3) != 0 {
+		x.Bytes(e.Bot_info.encode())
+	}
 	x.Int(e.Common_chats_count)
 	return x.buf
 }
@@ -6447,10 +6503,18 @@ func (e TL_updateShortMessage) encode() []byte {
 	x.Int(e.Pts)
 	x.Int(e.Pts_count)
 	x.Int(e.Date)
-	x.Bytes(e.Fwd_from.encode())
-	x.Int(e.Via_bot_id)
-	x.Int(e.Reply_to_msg_id)
-	x.Vector(e.Entities)
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Fwd_from.encode())
+	}
+	if e.Flags&(1<<11) != 0 {
+		x.Int(e.Via_bot_id)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.Int(e.Reply_to_msg_id)
+	}
+	if e.Flags&(1<<7) != 0 {
+		x.Vector(e.Entities)
+	}
 	return x.buf
 }
 
@@ -6465,10 +6529,18 @@ func (e TL_updateShortChatMessage) encode() []byte {
 	x.Int(e.Pts)
 	x.Int(e.Pts_count)
 	x.Int(e.Date)
-	x.Bytes(e.Fwd_from.encode())
-	x.Int(e.Via_bot_id)
-	x.Int(e.Reply_to_msg_id)
-	x.Vector(e.Entities)
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Fwd_from.encode())
+	}
+	if e.Flags&(1<<11) != 0 {
+		x.Int(e.Via_bot_id)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.Int(e.Reply_to_msg_id)
+	}
+	if e.Flags&(1<<7) != 0 {
+		x.Vector(e.Entities)
+	}
 	return x.buf
 }
 
@@ -6556,15 +6628,21 @@ func (e TL_config) encode() []byte {
 	x.Int(e.Rating_e_decay)
 	x.Int(e.Stickers_recent_limit)
 	x.Int(e.Stickers_faved_limit)
-	x.Int(e.Tmp_sessions)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Tmp_sessions)
+	}
 	x.Int(e.Pinned_dialogs_count_max)
 	x.Int(e.Call_receive_timeout_ms)
 	x.Int(e.Call_ring_timeout_ms)
 	x.Int(e.Call_connect_timeout_ms)
 	x.Int(e.Call_packet_timeout_ms)
 	x.String(e.Me_url_prefix)
-	x.String(e.Suggested_lang_code)
-	x.Int(e.Lang_pack_version)
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Suggested_lang_code)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Int(e.Lang_pack_version)
+	}
 	x.Vector(e.Disabled_features)
 	return x.buf
 }
@@ -6900,12 +6978,18 @@ func (e TL_inputMediaUploadedDocument) encode() []byte {
 	x.UInt(crc_inputMediaUploadedDocument)
 	x.Int(e.Flags)
 	x.Bytes(e.File.encode())
-	x.Bytes(e.Thumb.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Thumb.encode())
+	}
 	x.String(e.Mime_type)
 	x.Vector(e.Attributes)
 	x.String(e.Caption)
-	x.Vector(e.Stickers)
-	x.Int(e.Ttl_seconds)
+	if e.Flags&(1<<0) != 0 {
+		x.Vector(e.Stickers)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Ttl_seconds)
+	}
 	return x.buf
 }
 
@@ -6915,7 +6999,9 @@ func (e TL_inputMediaDocument) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e.Id.encode())
 	x.String(e.Caption)
-	x.Int(e.Ttl_seconds)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Ttl_seconds)
+	}
 	return x.buf
 }
 
@@ -6923,9 +7009,15 @@ func (e TL_messageMediaDocument) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_messageMediaDocument)
 	x.Int(e.Flags)
-	x.Bytes(e.Document.encode())
-	x.String(e.Caption)
-	x.Int(e.Ttl_seconds)
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Document.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Caption)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Int(e.Ttl_seconds)
+	}
 	return x.buf
 }
 
@@ -7091,7 +7183,9 @@ func (e TL_updateServiceNotification) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_updateServiceNotification)
 	x.Int(e.Flags)
-	x.Int(e.Inbox_date)
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Inbox_date)
+	}
 	x.String(e._Type)
 	x.String(e.Message)
 	x.Bytes(e.Media.encode())
@@ -7264,7 +7358,9 @@ func (e TL_documentAttributeSticker) encode() []byte {
 	x.Int(e.Flags)
 	x.String(e.Alt)
 	x.Bytes(e.Stickerset.encode())
-	x.Bytes(e.Mask_coords.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Mask_coords.encode())
+	}
 	return x.buf
 }
 
@@ -7283,9 +7379,15 @@ func (e TL_documentAttributeAudio) encode() []byte {
 	x.UInt(crc_documentAttributeAudio)
 	x.Int(e.Flags)
 	x.Int(e.Duration)
-	x.String(e.Title)
-	x.String(e.Performer)
-	x.StringBytes(e.Waveform)
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Title)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Performer)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.StringBytes(e.Waveform)
+	}
 	return x.buf
 }
 
@@ -7435,19 +7537,45 @@ func (e TL_webPage) encode() []byte {
 	x.String(e.Url)
 	x.String(e.Display_url)
 	x.Int(e.Hash)
-	x.String(e._Type)
-	x.String(e.Site_name)
-	x.String(e.Title)
-	x.String(e.Description)
-	x.Bytes(e.Photo.encode())
-	x.String(e.Embed_url)
-	x.String(e.Embed_type)
-	x.Int(e.Embed_width)
-	x.Int(e.Embed_height)
-	x.Int(e.Duration)
-	x.String(e.Author)
-	x.Bytes(e.Document.encode())
-	x.Bytes(e.Cached_page.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.String(e._Type)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Site_name)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Title)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.String(e.Description)
+	}
+	if e.Flags&(1<<4) != 0 {
+		x.Bytes(e.Photo.encode())
+	}
+	if e.Flags&(1<<5) != 0 {
+		x.String(e.Embed_url)
+	}
+	if e.Flags&(1<<5) != 0 {
+		x.String(e.Embed_type)
+	}
+	if e.Flags&(1<<6) != 0 {
+		x.Int(e.Embed_width)
+	}
+	if e.Flags&(1<<6) != 0 {
+		x.Int(e.Embed_height)
+	}
+	if e.Flags&(1<<7) != 0 {
+		x.Int(e.Duration)
+	}
+	if e.Flags&(1<<8) != 0 {
+		x.String(e.Author)
+	}
+	if e.Flags&(1<<9) != 0 {
+		x.Bytes(e.Document.encode())
+	}
+	if e.Flags&(1<<10) != 0 {
+		x.Bytes(e.Cached_page.encode())
+	}
 	return x.buf
 }
 
@@ -7495,10 +7623,18 @@ func (e TL_account_passwordInputSettings) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_account_passwordInputSettings)
 	x.Int(e.Flags)
-	x.StringBytes(e.New_salt)
-	x.StringBytes(e.New_password_hash)
-	x.String(e.Hint)
-	x.String(e.Email)
+	if e.Flags&(1<<0) != 0 {
+		x.StringBytes(e.New_salt)
+	}
+	if e.Flags&(1<<0) != 0 {
+		x.StringBytes(e.New_password_hash)
+	}
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Hint)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Email)
+	}
 	return x.buf
 }
 
@@ -7566,7 +7702,9 @@ func (e TL_chatInvite) encode() []byte {
 	x.String(e.Title)
 	x.Bytes(e.Photo.encode())
 	x.Int(e.Participants_count)
-	x.Vector(e.Participants)
+	if e.Flags&(1<<4) != 0 {
+		x.Vector(e.Participants)
+	}
 	return x.buf
 }
 
@@ -7634,17 +7772,39 @@ func (e TL_user) encode() []byte {
 	x.UInt(crc_user)
 	x.Int(e.Flags)
 	x.Int(e.Id)
-	x.Long(e.Access_hash)
-	x.String(e.First_name)
-	x.String(e.Last_name)
-	x.String(e.Username)
-	x.String(e.Phone)
-	x.Bytes(e.Photo.encode())
-	x.Bytes(e.Status.encode())
-	x.Int(e.Bot_info_version)
-	x.String(e.Restriction_reason)
-	x.String(e.Bot_inline_placeholder)
-	x.String(e.Lang_code)
+	if e.Flags&(1<<0) != 0 {
+		x.Long(e.Access_hash)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.First_name)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Last_name)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.String(e.Username)
+	}
+	if e.Flags&(1<<4) != 0 {
+		x.String(e.Phone)
+	}
+	if e.Flags&(1<<5) != 0 {
+		x.Bytes(e.Photo.encode())
+	}
+	if e.Flags&(1<<6) != 0 {
+		x.Bytes(e.Status.encode())
+	}
+	if e.Flags&(1<<14) != 0 {
+		x.Int(e.Bot_info_version)
+	}
+	if e.Flags&(1<<18) != 0 {
+		x.String(e.Restriction_reason)
+	}
+	if e.Flags&(1<<19) != 0 {
+		x.String(e.Bot_inline_placeholder)
+	}
+	if e.Flags&(1<<22) != 0 {
+		x.String(e.Lang_code)
+	}
 	return x.buf
 }
 
@@ -7821,8 +7981,12 @@ func (e TL_updateShortSentMessage) encode() []byte {
 	x.Int(e.Pts)
 	x.Int(e.Pts_count)
 	x.Int(e.Date)
-	x.Bytes(e.Media.encode())
-	x.Vector(e.Entities)
+	if e.Flags&(1<<9) != 0 {
+		x.Bytes(e.Media.encode())
+	}
+	if e.Flags&(1<<7) != 0 {
+		x.Vector(e.Entities)
+	}
 	return x.buf
 }
 
@@ -7846,15 +8010,25 @@ func (e TL_channel) encode() []byte {
 	x.UInt(crc_channel)
 	x.Int(e.Flags)
 	x.Int(e.Id)
-	x.Long(e.Access_hash)
+	if e.Flags&(1<<13) != 0 {
+		x.Long(e.Access_hash)
+	}
 	x.String(e.Title)
-	x.String(e.Username)
+	if e.Flags&(1<<6) != 0 {
+		x.String(e.Username)
+	}
 	x.Bytes(e.Photo.encode())
 	x.Int(e.Date)
 	x.Int(e.Version)
-	x.String(e.Restriction_reason)
-	x.Bytes(e.Admin_rights.encode())
-	x.Bytes(e.Banned_rights.encode())
+	if e.Flags&(1<<9) != 0 {
+		x.String(e.Restriction_reason)
+	}
+	if e.Flags&(1<<14) != 0 {
+		x.Bytes(e.Admin_rights.encode())
+	}
+	if e.Flags&(1<<15) != 0 {
+		x.Bytes(e.Banned_rights.encode())
+	}
 	return x.buf
 }
 
@@ -7865,7 +8039,9 @@ func (e TL_channelForbidden) encode() []byte {
 	x.Int(e.Id)
 	x.Long(e.Access_hash)
 	x.String(e.Title)
-	x.Int(e.Until_date)
+	if e.Flags&(1<<16) != 0 {
+		x.Int(e.Until_date)
+	}
 	return x.buf
 }
 
@@ -7875,10 +8051,18 @@ func (e TL_channelFull) encode() []byte {
 	x.Int(e.Flags)
 	x.Int(e.Id)
 	x.String(e.About)
-	x.Int(e.Participants_count)
-	x.Int(e.Admins_count)
-	x.Int(e.Kicked_count)
-	x.Int(e.Banned_count)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Participants_count)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Admins_count)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Int(e.Kicked_count)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Int(e.Banned_count)
+	}
 	x.Int(e.Read_inbox_max_id)
 	x.Int(e.Read_outbox_max_id)
 	x.Int(e.Unread_count)
@@ -7886,10 +8070,18 @@ func (e TL_channelFull) encode() []byte {
 	x.Bytes(e.Notify_settings.encode())
 	x.Bytes(e.Exported_invite.encode())
 	x.Vector(e.Bot_info)
-	x.Int(e.Migrated_from_chat_id)
-	x.Int(e.Migrated_from_max_id)
-	x.Int(e.Pinned_msg_id)
-	x.Bytes(e.Stickerset.encode())
+	if e.Flags&(1<<4) != 0 {
+		x.Int(e.Migrated_from_chat_id)
+	}
+	if e.Flags&(1<<4) != 0 {
+		x.Int(e.Migrated_from_max_id)
+	}
+	if e.Flags&(1<<5) != 0 {
+		x.Int(e.Pinned_msg_id)
+	}
+	if e.Flags&(1<<8) != 0 {
+		x.Bytes(e.Stickerset.encode())
+	}
 	return x.buf
 }
 
@@ -7917,7 +8109,9 @@ func (e TL_updateChannelTooLong) encode() []byte {
 	x.UInt(crc_updateChannelTooLong)
 	x.Int(e.Flags)
 	x.Int(e.Channel_id)
-	x.Int(e.Pts)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Pts)
+	}
 	return x.buf
 }
 
@@ -8000,7 +8194,9 @@ func (e TL_updates_channelDifferenceEmpty) encode() []byte {
 	x.UInt(crc_updates_channelDifferenceEmpty)
 	x.Int(e.Flags)
 	x.Int(e.Pts)
-	x.Int(e.Timeout)
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Timeout)
+	}
 	return x.buf
 }
 
@@ -8009,7 +8205,9 @@ func (e TL_updates_channelDifferenceTooLong) encode() []byte {
 	x.UInt(crc_updates_channelDifferenceTooLong)
 	x.Int(e.Flags)
 	x.Int(e.Pts)
-	x.Int(e.Timeout)
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Timeout)
+	}
 	x.Int(e.Top_message)
 	x.Int(e.Read_inbox_max_id)
 	x.Int(e.Read_outbox_max_id)
@@ -8026,7 +8224,9 @@ func (e TL_updates_channelDifference) encode() []byte {
 	x.UInt(crc_updates_channelDifference)
 	x.Int(e.Flags)
 	x.Int(e.Pts)
-	x.Int(e.Timeout)
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Timeout)
+	}
 	x.Vector(e.New_messages)
 	x.Vector(e.Other_updates)
 	x.Vector(e.Chats)
@@ -8270,7 +8470,9 @@ func (e TL_updateBotInlineQuery) encode() []byte {
 	x.Long(e.Query_id)
 	x.Int(e.User_id)
 	x.String(e.Query)
-	x.Bytes(e.Geo.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Geo.encode())
+	}
 	x.String(e.Offset)
 	return x.buf
 }
@@ -8303,7 +8505,9 @@ func (e TL_inputBotInlineMessageMediaAuto) encode() []byte {
 	x.UInt(crc_inputBotInlineMessageMediaAuto)
 	x.Int(e.Flags)
 	x.String(e.Caption)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8312,8 +8516,12 @@ func (e TL_inputBotInlineMessageText) encode() []byte {
 	x.UInt(crc_inputBotInlineMessageText)
 	x.Int(e.Flags)
 	x.String(e.Message)
-	x.Vector(e.Entities)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<1) != 0 {
+		x.Vector(e.Entities)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8323,15 +8531,33 @@ func (e TL_inputBotInlineResult) encode() []byte {
 	x.Int(e.Flags)
 	x.String(e.Id)
 	x.String(e._Type)
-	x.String(e.Title)
-	x.String(e.Description)
-	x.String(e.Url)
-	x.String(e.Thumb_url)
-	x.String(e.Content_url)
-	x.String(e.Content_type)
-	x.Int(e.W)
-	x.Int(e.H)
-	x.Int(e.Duration)
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Title)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Description)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.String(e.Url)
+	}
+	if e.Flags&(1<<4) != 0 {
+		x.String(e.Thumb_url)
+	}
+	if e.Flags&(1<<5) != 0 {
+		x.String(e.Content_url)
+	}
+	if e.Flags&(1<<5) != 0 {
+		x.String(e.Content_type)
+	}
+	if e.Flags&(1<<6) != 0 {
+		x.Int(e.W)
+	}
+	if e.Flags&(1<<6) != 0 {
+		x.Int(e.H)
+	}
+	if e.Flags&(1<<7) != 0 {
+		x.Int(e.Duration)
+	}
 	x.Bytes(e.Send_message.encode())
 	return x.buf
 }
@@ -8341,7 +8567,9 @@ func (e TL_botInlineMessageMediaAuto) encode() []byte {
 	x.UInt(crc_botInlineMessageMediaAuto)
 	x.Int(e.Flags)
 	x.String(e.Caption)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8350,8 +8578,12 @@ func (e TL_botInlineMessageText) encode() []byte {
 	x.UInt(crc_botInlineMessageText)
 	x.Int(e.Flags)
 	x.String(e.Message)
-	x.Vector(e.Entities)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<1) != 0 {
+		x.Vector(e.Entities)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8361,15 +8593,33 @@ func (e TL_botInlineResult) encode() []byte {
 	x.Int(e.Flags)
 	x.String(e.Id)
 	x.String(e._Type)
-	x.String(e.Title)
-	x.String(e.Description)
-	x.String(e.Url)
-	x.String(e.Thumb_url)
-	x.String(e.Content_url)
-	x.String(e.Content_type)
-	x.Int(e.W)
-	x.Int(e.H)
-	x.Int(e.Duration)
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Title)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Description)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.String(e.Url)
+	}
+	if e.Flags&(1<<4) != 0 {
+		x.String(e.Thumb_url)
+	}
+	if e.Flags&(1<<5) != 0 {
+		x.String(e.Content_url)
+	}
+	if e.Flags&(1<<5) != 0 {
+		x.String(e.Content_type)
+	}
+	if e.Flags&(1<<6) != 0 {
+		x.Int(e.W)
+	}
+	if e.Flags&(1<<6) != 0 {
+		x.Int(e.H)
+	}
+	if e.Flags&(1<<7) != 0 {
+		x.Int(e.Duration)
+	}
 	x.Bytes(e.Send_message.encode())
 	return x.buf
 }
@@ -8379,8 +8629,12 @@ func (e TL_messages_botResults) encode() []byte {
 	x.UInt(crc_messages_botResults)
 	x.Int(e.Flags)
 	x.Long(e.Query_id)
-	x.String(e.Next_offset)
-	x.Bytes(e.Switch_pm.encode())
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Next_offset)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Switch_pm.encode())
+	}
 	x.Vector(e.Results)
 	x.Int(e.Cache_time)
 	return x.buf
@@ -8404,9 +8658,13 @@ func (e TL_updateBotInlineSend) encode() []byte {
 	x.Int(e.Flags)
 	x.Int(e.User_id)
 	x.String(e.Query)
-	x.Bytes(e.Geo.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Geo.encode())
+	}
 	x.String(e.Id)
-	x.Bytes(e.Msg_id.encode())
+	if e.Flags&(1<<1) != 0 {
+		x.Bytes(e.Msg_id.encode())
+	}
 	return x.buf
 }
 
@@ -8442,11 +8700,19 @@ func (e TL_messageFwdHeader) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_messageFwdHeader)
 	x.Int(e.Flags)
-	x.Int(e.From_id)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.From_id)
+	}
 	x.Int(e.Date)
-	x.Int(e.Channel_id)
-	x.Int(e.Channel_post)
-	x.String(e.Post_author)
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Channel_id)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Int(e.Channel_post)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.String(e.Post_author)
+	}
 	return x.buf
 }
 
@@ -8567,8 +8833,12 @@ func (e TL_messages_botCallbackAnswer) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_messages_botCallbackAnswer)
 	x.Int(e.Flags)
-	x.String(e.Message)
-	x.String(e.Url)
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Message)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Url)
+	}
 	x.Int(e.Cache_time)
 	return x.buf
 }
@@ -8582,8 +8852,12 @@ func (e TL_updateBotCallbackQuery) encode() []byte {
 	x.Bytes(e.Peer.encode())
 	x.Int(e.Msg_id)
 	x.Long(e.Chat_instance)
-	x.StringBytes(e.Data)
-	x.String(e.Game_short_name)
+	if e.Flags&(1<<0) != 0 {
+		x.StringBytes(e.Data)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Game_short_name)
+	}
 	return x.buf
 }
 
@@ -8608,7 +8882,9 @@ func (e TL_inputBotInlineMessageMediaGeo) encode() []byte {
 	x.UInt(crc_inputBotInlineMessageMediaGeo)
 	x.Int(e.Flags)
 	x.Bytes(e.Geo_point.encode())
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8621,7 +8897,9 @@ func (e TL_inputBotInlineMessageMediaVenue) encode() []byte {
 	x.String(e.Address)
 	x.String(e.Provider)
 	x.String(e.Venue_id)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8632,7 +8910,9 @@ func (e TL_inputBotInlineMessageMediaContact) encode() []byte {
 	x.String(e.Phone_number)
 	x.String(e.First_name)
 	x.String(e.Last_name)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8641,7 +8921,9 @@ func (e TL_botInlineMessageMediaGeo) encode() []byte {
 	x.UInt(crc_botInlineMessageMediaGeo)
 	x.Int(e.Flags)
 	x.Bytes(e.Geo.encode())
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8654,7 +8936,9 @@ func (e TL_botInlineMessageMediaVenue) encode() []byte {
 	x.String(e.Address)
 	x.String(e.Provider)
 	x.String(e.Venue_id)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8665,7 +8949,9 @@ func (e TL_botInlineMessageMediaContact) encode() []byte {
 	x.String(e.Phone_number)
 	x.String(e.First_name)
 	x.String(e.Last_name)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -8685,8 +8971,12 @@ func (e TL_inputBotInlineResultDocument) encode() []byte {
 	x.Int(e.Flags)
 	x.String(e.Id)
 	x.String(e._Type)
-	x.String(e.Title)
-	x.String(e.Description)
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Title)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Description)
+	}
 	x.Bytes(e.Document.encode())
 	x.Bytes(e.Send_message.encode())
 	return x.buf
@@ -8698,10 +8988,18 @@ func (e TL_botInlineMediaResult) encode() []byte {
 	x.Int(e.Flags)
 	x.String(e.Id)
 	x.String(e._Type)
-	x.Bytes(e.Photo.encode())
-	x.Bytes(e.Document.encode())
-	x.String(e.Title)
-	x.String(e.Description)
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Photo.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Bytes(e.Document.encode())
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Title)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.String(e.Description)
+	}
 	x.Bytes(e.Send_message.encode())
 	return x.buf
 }
@@ -8723,8 +9021,12 @@ func (e TL_updateInlineBotCallbackQuery) encode() []byte {
 	x.Int(e.User_id)
 	x.Bytes(e.Msg_id.encode())
 	x.Long(e.Chat_instance)
-	x.StringBytes(e.Data)
-	x.String(e.Game_short_name)
+	if e.Flags&(1<<0) != 0 {
+		x.StringBytes(e.Data)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Game_short_name)
+	}
 	return x.buf
 }
 
@@ -8859,9 +9161,13 @@ func (e TL_draftMessage) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_draftMessage)
 	x.Int(e.Flags)
-	x.Int(e.Reply_to_msg_id)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Reply_to_msg_id)
+	}
 	x.String(e.Message)
-	x.Vector(e.Entities)
+	if e.Flags&(1<<3) != 0 {
+		x.Vector(e.Entities)
+	}
 	x.Int(e.Date)
 	return x.buf
 }
@@ -8948,7 +9254,9 @@ func (e TL_inputMediaPhotoExternal) encode() []byte {
 	x.Int(e.Flags)
 	x.String(e.Url)
 	x.String(e.Caption)
-	x.Int(e.Ttl_seconds)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Ttl_seconds)
+	}
 	return x.buf
 }
 
@@ -8958,7 +9266,9 @@ func (e TL_inputMediaDocumentExternal) encode() []byte {
 	x.Int(e.Flags)
 	x.String(e.Url)
 	x.String(e.Caption)
-	x.Int(e.Ttl_seconds)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Ttl_seconds)
+	}
 	return x.buf
 }
 
@@ -9045,7 +9355,9 @@ func (e TL_inputBotInlineMessageGame) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_inputBotInlineMessageGame)
 	x.Int(e.Flags)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -9068,7 +9380,9 @@ func (e TL_game) encode() []byte {
 	x.String(e.Title)
 	x.String(e.Description)
 	x.Bytes(e.Photo.encode())
-	x.Bytes(e.Document.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Document.encode())
+	}
 	return x.buf
 }
 
@@ -9330,9 +9644,15 @@ func (e TL_pageBlockEmbed) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_pageBlockEmbed)
 	x.Int(e.Flags)
-	x.String(e.Url)
-	x.String(e.Html)
-	x.Long(e.Poster_photo_id)
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Url)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Html)
+	}
+	if e.Flags&(1<<4) != 0 {
+		x.Long(e.Poster_photo_id)
+	}
 	x.Int(e.W)
 	x.Int(e.H)
 	x.Bytes(e.Caption.encode())
@@ -9397,7 +9717,9 @@ func (e TL_updatePinnedDialogs) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_updatePinnedDialogs)
 	x.Int(e.Flags)
-	x.Vector(e.Order)
+	if e.Flags&(1<<0) != 0 {
+		x.Vector(e.Order)
+	}
 	return x.buf
 }
 
@@ -9459,7 +9781,9 @@ func (e TL_phoneCallWaiting) encode() []byte {
 	x.Int(e.Admin_id)
 	x.Int(e.Participant_id)
 	x.Bytes(e.Protocol.encode())
-	x.Int(e.Receive_date)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Receive_date)
+	}
 	return x.buf
 }
 
@@ -9498,8 +9822,12 @@ func (e TL_phoneCallDiscarded) encode() []byte {
 	x.UInt(crc_phoneCallDiscarded)
 	x.Int(e.Flags)
 	x.Long(e.Id)
-	x.Bytes(e.Reason.encode())
-	x.Int(e.Duration)
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Reason.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Duration)
+	}
 	return x.buf
 }
 
@@ -9567,8 +9895,12 @@ func (e TL_messageActionPhoneCall) encode() []byte {
 	x.UInt(crc_messageActionPhoneCall)
 	x.Int(e.Flags)
 	x.Long(e.Call_id)
-	x.Bytes(e.Reason.encode())
-	x.Int(e.Duration)
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Reason.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Int(e.Duration)
+	}
 	return x.buf
 }
 
@@ -9587,7 +9919,9 @@ func (e TL_inputMediaInvoice) encode() []byte {
 	x.Int(e.Flags)
 	x.String(e.Title)
 	x.String(e.Description)
-	x.Bytes(e.Photo.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Photo.encode())
+	}
 	x.Bytes(e.Invoice.encode())
 	x.StringBytes(e.Payload)
 	x.String(e.Provider)
@@ -9602,8 +9936,12 @@ func (e TL_messageActionPaymentSentMe) encode() []byte {
 	x.String(e.Currency)
 	x.Long(e.Total_amount)
 	x.StringBytes(e.Payload)
-	x.Bytes(e.Info.encode())
-	x.String(e.Shipping_option_id)
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Info.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Shipping_option_id)
+	}
 	x.Bytes(e.Charge.encode())
 	return x.buf
 }
@@ -9614,8 +9952,12 @@ func (e TL_messageMediaInvoice) encode() []byte {
 	x.Int(e.Flags)
 	x.String(e.Title)
 	x.String(e.Description)
-	x.Bytes(e.Photo.encode())
-	x.Int(e.Receipt_msg_id)
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Photo.encode())
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Int(e.Receipt_msg_id)
+	}
 	x.String(e.Currency)
 	x.Long(e.Total_amount)
 	x.String(e.Start_param)
@@ -9645,10 +9987,18 @@ func (e TL_payments_paymentForm) encode() []byte {
 	x.Bytes(e.Invoice.encode())
 	x.Int(e.Provider_id)
 	x.String(e.Url)
-	x.String(e.Native_provider)
-	x.Bytes(e.Native_params.encode())
-	x.Bytes(e.Saved_info.encode())
-	x.Bytes(e.Saved_credentials.encode())
+	if e.Flags&(1<<4) != 0 {
+		x.String(e.Native_provider)
+	}
+	if e.Flags&(1<<4) != 0 {
+		x.Bytes(e.Native_params.encode())
+	}
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Saved_info.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Bytes(e.Saved_credentials.encode())
+	}
 	x.Vector(e.Users)
 	return x.buf
 }
@@ -9669,10 +10019,18 @@ func (e TL_paymentRequestedInfo) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_paymentRequestedInfo)
 	x.Int(e.Flags)
-	x.String(e.Name)
-	x.String(e.Phone)
-	x.String(e.Email)
-	x.Bytes(e.Shipping_address.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Name)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Phone)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Email)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.Bytes(e.Shipping_address.encode())
+	}
 	return x.buf
 }
 
@@ -9709,8 +10067,12 @@ func (e TL_updateBotPrecheckoutQuery) encode() []byte {
 	x.Long(e.Query_id)
 	x.Int(e.User_id)
 	x.StringBytes(e.Payload)
-	x.Bytes(e.Info.encode())
-	x.String(e.Shipping_option_id)
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Info.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Shipping_option_id)
+	}
 	x.String(e.Currency)
 	x.Long(e.Total_amount)
 	return x.buf
@@ -9792,8 +10154,12 @@ func (e TL_payments_validatedRequestedInfo) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_payments_validatedRequestedInfo)
 	x.Int(e.Flags)
-	x.String(e.Id)
-	x.Vector(e.Shipping_options)
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Id)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Vector(e.Shipping_options)
+	}
 	return x.buf
 }
 
@@ -9819,8 +10185,12 @@ func (e TL_payments_paymentReceipt) encode() []byte {
 	x.Int(e.Bot_id)
 	x.Bytes(e.Invoice.encode())
 	x.Int(e.Provider_id)
-	x.Bytes(e.Info.encode())
-	x.Bytes(e.Shipping.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Info.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Bytes(e.Shipping.encode())
+	}
 	x.String(e.Currency)
 	x.Long(e.Total_amount)
 	x.String(e.Credentials_title)
@@ -9832,7 +10202,9 @@ func (e TL_payments_savedInfo) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_payments_savedInfo)
 	x.Int(e.Flags)
-	x.Bytes(e.Saved_info.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Saved_info.encode())
+	}
 	return x.buf
 }
 
@@ -9973,7 +10345,9 @@ func (e TL_inputStickerSetItem) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e.Document.encode())
 	x.String(e.Emoji)
-	x.Bytes(e.Mask_coords.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Mask_coords.encode())
+	}
 	return x.buf
 }
 
@@ -9990,11 +10364,21 @@ func (e TL_langPackStringPluralized) encode() []byte {
 	x.UInt(crc_langPackStringPluralized)
 	x.Int(e.Flags)
 	x.String(e.Key)
-	x.String(e.Zero_value)
-	x.String(e.One_value)
-	x.String(e.Two_value)
-	x.String(e.Few_value)
-	x.String(e.Many_value)
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Zero_value)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.One_value)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Two_value)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.String(e.Few_value)
+	}
+	if e.Flags&(1<<4) != 0 {
+		x.String(e.Many_value)
+	}
 	x.String(e.Other_value)
 	return x.buf
 }
@@ -10326,7 +10710,9 @@ func (e TL_auth_sendCode) encode() []byte {
 	x.UInt(crc_auth_sendCode)
 	x.Int(e.Flags)
 	x.String(e.Phone_number)
-	x.Bytes(e.Current_number.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Current_number.encode())
+	}
 	x.Int(e.Api_id)
 	x.String(e.Api_hash)
 	return x.buf
@@ -10428,9 +10814,15 @@ func (e TL_account_updateProfile) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_account_updateProfile)
 	x.Int(e.Flags)
-	x.String(e.First_name)
-	x.String(e.Last_name)
-	x.String(e.About)
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.First_name)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Last_name)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.About)
+	}
 	return x.buf
 }
 
@@ -10562,7 +10954,9 @@ func (e TL_messages_search) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e.Peer.encode())
 	x.String(e.Q)
-	x.Bytes(e.From_id.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.From_id.encode())
+	}
 	x.Bytes(e.Filter.encode())
 	x.Int(e.Min_date)
 	x.Int(e.Max_date)
@@ -10619,17 +11013,17 @@ func (e TL_messages_sendMessage) encode() []byte {
 	x.UInt(crc_messages_sendMessage)
 	x.Int(e.Flags)
 	x.Bytes(e.Peer.encode())
-	if e.Reply_to_msg_id != 0 {
+	if e.Flags&(1<<0) != 0 {
 		x.Int(e.Reply_to_msg_id)
 	}
 	x.String(e.Message)
 	x.Long(e.Random_id)
-	if _, ok := (e.Reply_markup).(TL_null); !ok {
+	if e.Flags&(1<<2) != 0 {
 		x.Bytes(e.Reply_markup.encode())
 	}
-	if len(e.Entities) > 0 {
+	if e.Flags&(1<<3) != 0 {
 		x.Vector(e.Entities)
-  }
+	}
 	return x.buf
 }
 
@@ -10638,10 +11032,14 @@ func (e TL_messages_sendMedia) encode() []byte {
 	x.UInt(crc_messages_sendMedia)
 	x.Int(e.Flags)
 	x.Bytes(e.Peer.encode())
-	x.Int(e.Reply_to_msg_id)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Reply_to_msg_id)
+	}
 	x.Bytes(e.Media.encode())
 	x.Long(e.Random_id)
-	x.Bytes(e.Reply_markup.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
 	return x.buf
 }
 
@@ -10722,7 +11120,9 @@ func (e TL_updates_getDifference) encode() []byte {
 	x.UInt(crc_updates_getDifference)
 	x.Int(e.Flags)
 	x.Int(e.Pts)
-	x.Int(e.Pts_total_limit)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Pts_total_limit)
+	}
 	x.Int(e.Date)
 	x.Int(e.Qts)
 	return x.buf
@@ -11030,7 +11430,9 @@ func (e TL_account_sendChangePhoneCode) encode() []byte {
 	x.UInt(crc_account_sendChangePhoneCode)
 	x.Int(e.Flags)
 	x.String(e.Phone_number)
-	x.Bytes(e.Current_number.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Current_number.encode())
+	}
 	return x.buf
 }
 
@@ -11484,7 +11886,9 @@ func (e TL_messages_getInlineBotResults) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e.Bot.encode())
 	x.Bytes(e.Peer.encode())
-	x.Bytes(e.Geo_point.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Geo_point.encode())
+	}
 	x.String(e.Query)
 	x.String(e.Offset)
 	return x.buf
@@ -11497,8 +11901,12 @@ func (e TL_messages_setInlineBotResults) encode() []byte {
 	x.Long(e.Query_id)
 	x.Vector(e.Results)
 	x.Int(e.Cache_time)
-	x.String(e.Next_offset)
-	x.Bytes(e.Switch_pm.encode())
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Next_offset)
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.Bytes(e.Switch_pm.encode())
+	}
 	return x.buf
 }
 
@@ -11507,7 +11915,9 @@ func (e TL_messages_sendInlineBotResult) encode() []byte {
 	x.UInt(crc_messages_sendInlineBotResult)
 	x.Int(e.Flags)
 	x.Bytes(e.Peer.encode())
-	x.Int(e.Reply_to_msg_id)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Reply_to_msg_id)
+	}
 	x.Long(e.Random_id)
 	x.Long(e.Query_id)
 	x.String(e.Id)
@@ -11591,9 +12001,15 @@ func (e TL_messages_editMessage) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e.Peer.encode())
 	x.Int(e.Id)
-	x.String(e.Message)
-	x.Bytes(e.Reply_markup.encode())
-	x.Vector(e.Entities)
+	if e.Flags&(1<<11) != 0 {
+		x.String(e.Message)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.Vector(e.Entities)
+	}
 	return x.buf
 }
 
@@ -11602,9 +12018,15 @@ func (e TL_messages_editInlineBotMessage) encode() []byte {
 	x.UInt(crc_messages_editInlineBotMessage)
 	x.Int(e.Flags)
 	x.Bytes(e.Id.encode())
-	x.String(e.Message)
-	x.Bytes(e.Reply_markup.encode())
-	x.Vector(e.Entities)
+	if e.Flags&(1<<11) != 0 {
+		x.String(e.Message)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.Bytes(e.Reply_markup.encode())
+	}
+	if e.Flags&(1<<3) != 0 {
+		x.Vector(e.Entities)
+	}
 	return x.buf
 }
 
@@ -11614,7 +12036,9 @@ func (e TL_messages_getBotCallbackAnswer) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e.Peer.encode())
 	x.Int(e.Msg_id)
-	x.StringBytes(e.Data)
+	if e.Flags&(1<<0) != 0 {
+		x.StringBytes(e.Data)
+	}
 	return x.buf
 }
 
@@ -11623,8 +12047,12 @@ func (e TL_messages_setBotCallbackAnswer) encode() []byte {
 	x.UInt(crc_messages_setBotCallbackAnswer)
 	x.Int(e.Flags)
 	x.Long(e.Query_id)
-	x.String(e.Message)
-	x.String(e.Url)
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Message)
+	}
+	if e.Flags&(1<<2) != 0 {
+		x.String(e.Url)
+	}
 	x.Int(e.Cache_time)
 	return x.buf
 }
@@ -11658,10 +12086,14 @@ func (e TL_messages_saveDraft) encode() []byte {
 	x := NewEncodeBuf(512)
 	x.UInt(crc_messages_saveDraft)
 	x.Int(e.Flags)
-	x.Int(e.Reply_to_msg_id)
+	if e.Flags&(1<<0) != 0 {
+		x.Int(e.Reply_to_msg_id)
+	}
 	x.Bytes(e.Peer.encode())
 	x.String(e.Message)
-	x.Vector(e.Entities)
+	if e.Flags&(1<<3) != 0 {
+		x.Vector(e.Entities)
+	}
 	return x.buf
 }
 
@@ -11676,7 +12108,9 @@ func (e TL_account_sendConfirmPhoneCode) encode() []byte {
 	x.UInt(crc_account_sendConfirmPhoneCode)
 	x.Int(e.Flags)
 	x.String(e.Hash)
-	x.Bytes(e.Current_number.encode())
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Current_number.encode())
+	}
 	return x.buf
 }
 
@@ -11909,8 +12343,12 @@ func (e TL_payments_sendPaymentForm) encode() []byte {
 	x.UInt(crc_payments_sendPaymentForm)
 	x.Int(e.Flags)
 	x.Int(e.Msg_id)
-	x.String(e.Requested_info_id)
-	x.String(e.Shipping_option_id)
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Requested_info_id)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.String(e.Shipping_option_id)
+	}
 	x.Bytes(e.Credentials.encode())
 	return x.buf
 }
@@ -11928,8 +12366,12 @@ func (e TL_messages_setBotShippingResults) encode() []byte {
 	x.UInt(crc_messages_setBotShippingResults)
 	x.Int(e.Flags)
 	x.Long(e.Query_id)
-	x.String(e.Error)
-	x.Vector(e.Shipping_options)
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Error)
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Vector(e.Shipping_options)
+	}
 	return x.buf
 }
 
@@ -11938,7 +12380,9 @@ func (e TL_messages_setBotPrecheckoutResults) encode() []byte {
 	x.UInt(crc_messages_setBotPrecheckoutResults)
 	x.Int(e.Flags)
 	x.Long(e.Query_id)
-	x.String(e.Error)
+	if e.Flags&(1<<0) != 0 {
+		x.String(e.Error)
+	}
 	return x.buf
 }
 
@@ -12114,8 +12558,12 @@ func (e TL_channels_getAdminLog) encode() []byte {
 	x.Int(e.Flags)
 	x.Bytes(e.Channel.encode())
 	x.String(e.Q)
-	x.Bytes(e.Events_filter.encode())
-	x.Vector(e.Admins)
+	if e.Flags&(1<<0) != 0 {
+		x.Bytes(e.Events_filter.encode())
+	}
+	if e.Flags&(1<<1) != 0 {
+		x.Vector(e.Admins)
+	}
 	x.Long(e.Max_id)
 	x.Long(e.Min_id)
 	x.Int(e.Limit)
@@ -0,0 +1,199 @@
+package mtproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// maxPacketSize limits the length read from the transport header
+const maxPacketSize = 16 * 1024 * 1024
+
+// Transport frames MTProto packets on a stream connection
+// https://core.telegram.org/mtproto/mtproto-transports
+type Transport interface {
+	// Init writes the header at the start of a new connection
+	Init(w io.Writer) error
+	WritePacket(w io.Writer, data []byte) error
+	ReadPacket(r io.Reader) ([]byte, error)
+}
+
+// NewTransport makes the Transport of a new connection, see WithTransport
+// rnd is the random source of the connection, see WithRandom
+type NewTransport func(rnd io.Reader) Transport
+
+// NewAbridgedTransport is the default transport: 0xef header, length in 4-byte words in 1 or 4 bytes
+func NewAbridgedTransport(rnd io.Reader) Transport {
+	return abridgedTransport{}
+}
+
+// NewIntermediateTransport: 0xeeeeeeee header, 4-byte length
+func NewIntermediateTransport(rnd io.Reader) Transport {
+	return intermediateTransport{}
+}
+
+// NewPaddedIntermediateTransport: 0xdddddddd header, 4-byte length and 0-15 random padding bytes from rnd
+func NewPaddedIntermediateTransport(rnd io.Reader) Transport {
+	return intermediateTransport{padded: true, rnd: rnd}
+}
+
+// NewFullTransport: no header, 4-byte length, 4-byte seqno and CRC32 of every packet
+func NewFullTransport(rnd io.Reader) Transport {
+	return &fullTransport{}
+}
+
+type abridgedTransport struct{}
+
+func (t abridgedTransport) Init(w io.Writer) error {
+	_, err := w.Write([]byte{0xef})
+	return err
+}
+
+func (t abridgedTransport) tag() []byte {
+	return []byte{0xef, 0xef, 0xef, 0xef}
+}
+
+func (t abridgedTransport) WritePacket(w io.Writer, data []byte) error {
+	if len(data)%4 != 0 {
+		return fmt.Errorf("Transport: packet length %d is not divisible by 4", len(data))
+	}
+	var header []byte
+	size := len(data) / 4
+	if size < 127 {
+		header = []byte{byte(size)}
+	} else {
+		header = make([]byte, 4)
+		binary.LittleEndian.PutUint32(header, uint32(size<<8|127))
+	}
+	_, err := w.Write(append(header, data...))
+	return err
+}
+
+func (t abridgedTransport) ReadPacket(r io.Reader) ([]byte, error) {
+	b := make([]byte, 4)
+	_, err := io.ReadFull(r, b[:1])
+	if err != nil {
+		return nil, err
+	}
+	size := int(b[0] & 0x7f)
+	if size == 127 {
+		_, err = io.ReadFull(r, b[:3])
+		if err != nil {
+			return nil, err
+		}
+		size = int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+	}
+	return readPacket(r, size*4)
+}
+
+type intermediateTransport struct {
+	padded bool
+	rnd    io.Reader
+}
+
+func (t intermediateTransport) Init(w io.Writer) error {
+	_, err := w.Write(t.tag())
+	return err
+}
+
+func (t intermediateTransport) tag() []byte {
+	if t.padded {
+		return []byte{0xdd, 0xdd, 0xdd, 0xdd}
+	}
+	return []byte{0xee, 0xee, 0xee, 0xee}
+}
+
+func (t intermediateTransport) WritePacket(w io.Writer, data []byte) error {
+	padding := 0
+	if t.padded {
+		var n [1]byte
+		_, err := io.ReadFull(t.rnd, n[:])
+		if err != nil {
+			return err
+		}
+		padding = int(n[0] % 16)
+	}
+	x := make([]byte, 4+len(data)+padding)
+	binary.LittleEndian.PutUint32(x, uint32(len(data)+padding))
+	copy(x[4:], data)
+	if padding > 0 {
+		_, err := io.ReadFull(t.rnd, x[4+len(data):])
+		if err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(x)
+	return err
+}
+
+// ReadPacket returns the padding too, the MTProto layer drops it
+func (t intermediateTransport) ReadPacket(r io.Reader) ([]byte, error) {
+	b := make([]byte, 4)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return nil, err
+	}
+	// the high bit is the quick ack flag
+	return readPacket(r, int(binary.LittleEndian.Uint32(b)&0x7fffffff))
+}
+
+type fullTransport struct {
+	sendSeqNo int32
+	readSeqNo int32
+}
+
+func (t *fullTransport) Init(w io.Writer) error {
+	return nil
+}
+
+func (t *fullTransport) WritePacket(w io.Writer, data []byte) error {
+	x := make([]byte, 12+len(data))
+	binary.LittleEndian.PutUint32(x, uint32(len(x)))
+	binary.LittleEndian.PutUint32(x[4:], uint32(t.sendSeqNo))
+	copy(x[8:], data)
+	binary.LittleEndian.PutUint32(x[8+len(data):], crc32.ChecksumIEEE(x[:8+len(data)]))
+	t.sendSeqNo++
+	_, err := w.Write(x)
+	return err
+}
+
+func (t *fullTransport) ReadPacket(r io.Reader) ([]byte, error) {
+	b := make([]byte, 4)
+	_, err := io.ReadFull(r, b)
+	if err != nil {
+		return nil, err
+	}
+	size := int(binary.LittleEndian.Uint32(b))
+	if size < 12 {
+		return nil, fmt.Errorf("Transport: wrong packet length %d", size)
+	}
+	x, err := readPacket(r, size-4)
+	if err != nil {
+		return nil, err
+	}
+	n := len(x) - 4
+	crc := crc32.Update(crc32.ChecksumIEEE(b), crc32.IEEETable, x[:n])
+	if crc != binary.LittleEndian.Uint32(x[n:]) {
+		return nil, errors.New("Transport: wrong CRC32")
+	}
+	seqNo := int32(binary.LittleEndian.Uint32(x))
+	if seqNo != t.readSeqNo {
+		return nil, fmt.Errorf("Transport: wrong seqno %d, need %d", seqNo, t.readSeqNo)
+	}
+	t.readSeqNo++
+	return x[4:n], nil
+}
+
+func readPacket(r io.Reader, size int) ([]byte, error) {
+	if size < 0 || size > maxPacketSize {
+		return nil, fmt.Errorf("Transport: wrong packet length %d", size)
+	}
+	buf := make([]byte, size)
+	_, err := io.ReadFull(r, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
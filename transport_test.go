@@ -0,0 +1,56 @@
+package mtproto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestTransports(t *testing.T) {
+	cases := map[string]struct {
+		transport NewTransport
+		header    []byte
+	}{
+		"abridged":            {NewAbridgedTransport, []byte{0xef}},
+		"intermediate":        {NewIntermediateTransport, []byte{0xee, 0xee, 0xee, 0xee}},
+		"padded intermediate": {NewPaddedIntermediateTransport, []byte{0xdd, 0xdd, 0xdd, 0xdd}},
+		"full":                {NewFullTransport, nil},
+	}
+	packets := [][]byte{
+		bytes.Repeat([]byte{1, 2, 3, 4}, 10),
+		bytes.Repeat([]byte{5, 6, 7, 8}, 1000),
+	}
+
+	for name, c := range cases {
+		var conn bytes.Buffer
+		send, recv := c.transport(rand.Reader), c.transport(rand.Reader)
+		if err := send.Init(&conn); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(conn.Next(len(c.header)), c.header) {
+			t.Errorf("%s: wrong header", name)
+		}
+		for _, p := range packets {
+			if err := send.WritePacket(&conn, p); err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+		}
+		for _, p := range packets {
+			got, err := recv.ReadPacket(&conn)
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			if !bytes.Equal(got[:len(p)], p) || len(got)-len(p) > 15 {
+				t.Errorf("%s: packet mismatch", name)
+			}
+		}
+	}
+
+	// full transport checks CRC32
+	var conn bytes.Buffer
+	_ = NewFullTransport(nil).WritePacket(&conn, packets[0])
+	conn.Bytes()[10] ^= 0xff
+	if _, err := NewFullTransport(nil).ReadPacket(&conn); err == nil {
+		t.Error("corrupted packet accepted")
+	}
+}
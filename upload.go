@@ -0,0 +1,159 @@
+package mtproto
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// UploadPartSize is the size of upload.saveFilePart parts
+	UploadPartSize = 512 * 1024
+	// BigFileSize is the size from which files are uploaded with upload.saveBigFilePart
+	BigFileSize = 10 * 1024 * 1024
+
+	uploadWorkers     = 4
+	maxUploadParts    = 3000
+	maxUploadAttempts = 3
+)
+
+// UploadFile uploads size bytes read from r and returns TL_inputFile or, for big files, TL_inputFileBig
+// The result can be used in InputMedia or photos.uploadProfilePhoto
+// Parts are uploaded concurrently, a failed part is repeated up to 3 times
+func (m *MTProto) UploadFile(ctx context.Context, r io.Reader, size int64, name string) (TL, error) {
+	if size <= 0 {
+		return nil, errors.New("UploadFile: empty file")
+	}
+	parts := (size + UploadPartSize - 1) / UploadPartSize
+	if parts > maxUploadParts {
+		return nil, fmt.Errorf("UploadFile: file is too big: %d", size)
+	}
+
+	id, err := m.randomInt64()
+	if err != nil {
+		return nil, err
+	}
+	u := &uploader{
+		m:     m,
+		id:    id,
+		big:   size >= BigFileSize,
+		parts: int32(parts),
+	}
+	var sum hash.Hash
+	if !u.big {
+		sum = md5.New()
+		r = io.TeeReader(r, sum)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	queue := make(chan filePart, uploadWorkers)
+	errs := make(chan error, uploadWorkers+1)
+	var wg sync.WaitGroup
+	for i := 0; i < uploadWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range queue {
+				err := u.savePart(ctx, p)
+				if err != nil {
+					errs <- err
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+
+	// the reader is sequential, parts are read here and saved by the workers
+	err = u.read(ctx, r, size, queue)
+	close(queue)
+	if err != nil {
+		errs <- err
+		cancel()
+	}
+	wg.Wait()
+	close(errs)
+	if err, ok := <-errs; ok {
+		return nil, err
+	}
+
+	if u.big {
+		return TL_inputFileBig{Id: u.id, Parts: u.parts, Name: name}, nil
+	}
+	return TL_inputFile{
+		Id:           u.id,
+		Parts:        u.parts,
+		Name:         name,
+		Md5_checksum: hex.EncodeToString(sum.Sum(nil)),
+	}, nil
+}
+
+type filePart struct {
+	n    int32
+	data []byte
+}
+
+type uploader struct {
+	m     *MTProto
+	id    int64
+	big   bool
+	parts int32
+}
+
+func (u *uploader) read(ctx context.Context, r io.Reader, size int64, queue chan<- filePart) error {
+	for n := int32(0); n < u.parts; n++ {
+		l := size - int64(n)*UploadPartSize
+		if l > UploadPartSize {
+			l = UploadPartSize
+		}
+		data := make([]byte, l)
+		_, err := io.ReadFull(r, data)
+		if err != nil {
+			return fmt.Errorf("UploadFile: part %d: %s", n, err)
+		}
+		select {
+		case queue <- filePart{n, data}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+// savePart uploads the part, repeating it on network errors and internal server errors
+func (u *uploader) savePart(ctx context.Context, p filePart) error {
+	var req TL
+	if u.big {
+		req = TL_upload_saveBigFilePart{u.id, p.n, u.parts, p.data}
+	} else {
+		req = TL_upload_saveFilePart{u.id, p.n, p.data}
+	}
+
+	for attempt := 1; ; attempt++ {
+		x, err := u.m.Invoke(ctx, req)
+		if err == nil {
+			if !toBool(x) {
+				return fmt.Errorf("UploadFile: part %d is not saved", p.n)
+			}
+			return nil
+		}
+		if ctx.Err() != nil || attempt >= maxUploadAttempts {
+			return err
+		}
+		if rpcErr, ok := AsRPCError(err); ok && rpcErr.Code < 500 {
+			return err
+		}
+		select {
+		case <-time.After(u.m.backoff.Delay(attempt - 1)):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
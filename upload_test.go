@@ -0,0 +1,66 @@
+package mtproto
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUploadFile(t *testing.T) {
+	var mutex sync.Mutex
+	saved := make(map[int32][]byte)
+	failed := false
+	m := &MTProto{backoff: Backoff{Min: time.Millisecond, Max: time.Millisecond, Factor: 1}}
+	m.invoker = func(ctx context.Context, req TL) (TL, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch r := req.(type) {
+		case TL_upload_saveFilePart:
+			if r.File_part == 1 && !failed {
+				failed = true
+				return nil, errors.New("connection reset")
+			}
+			saved[r.File_part] = r.Bytes
+		case TL_upload_saveBigFilePart:
+			if r.File_total_parts != 21 {
+				return nil, NewRPCError(400, "FILE_PARTS_INVALID")
+			}
+			saved[r.File_part] = r.Bytes
+		}
+		return TL_boolTrue{}, nil
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 150000)
+	x, err := m.UploadFile(context.Background(), bytes.NewReader(data), int64(len(data)), "file.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(data)
+	f, ok := x.(TL_inputFile)
+	if !ok || f.Parts != 3 || f.Name != "file.txt" || f.Md5_checksum != hex.EncodeToString(sum[:]) {
+		t.Fatalf("got %#v", x)
+	}
+	got := append(append(append([]byte{}, saved[0]...), saved[1]...), saved[2]...)
+	if !failed || !bytes.Equal(got, data) {
+		t.Error("parts mismatch")
+	}
+
+	big := make([]byte, 20*UploadPartSize+1)
+	x, err = m.UploadFile(context.Background(), bytes.NewReader(big), int64(len(big)), "big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fb, ok := x.(TL_inputFileBig); !ok || fb.Parts != 21 {
+		t.Errorf("got %#v", x)
+	}
+
+	_, err = m.UploadFile(context.Background(), bytes.NewReader(data[:10]), int64(len(data)), "short")
+	if err == nil {
+		t.Error("short reader accepted")
+	}
+}
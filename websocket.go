@@ -0,0 +1,300 @@
+package mtproto
+
+import (
+	"bufio"
+	"context"
+	sha1lib "crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	wsOpContinuation = 0x0
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// wsCloseTimeout limits the write of the close frame, the peer may not read anymore
+	wsCloseTimeout = time.Second
+)
+
+var webSocketHosts = map[int32]string{
+	1: "pluto",
+	2: "venus",
+	3: "aurora",
+	4: "vesta",
+	5: "flora",
+}
+
+// WebSocketEndpoint returns the Telegram /apiws URL of the DC, see WithWebSocket
+func WebSocketEndpoint(dc int32) string {
+	host, ok := webSocketHosts[dc]
+	if !ok {
+		host = webSocketHosts[2]
+	}
+	return fmt.Sprintf("wss://%s.web.telegram.org/apiws", host)
+}
+
+// WebSocketTestEndpoint returns the /apiws_test URL of the test DC, see WithWebSocket and WithTestServers
+func WebSocketTestEndpoint(dc int32) string {
+	return WebSocketEndpoint(dc) + "_test"
+}
+
+// dialWebSocket opens a WebSocket with the binary subprotocol at rawurl (ws:// or wss://)
+// The returned connection is a byte stream, every Write is sent as one binary message
+// rnd is the source of the handshake key and the frame masks
+func dialWebSocket(ctx context.Context, dialer ContextDialer, rawurl string, rnd io.Reader) (net.Conn, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+	case "wss":
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: u.Hostname()})
+		err = tlsConn.HandshakeContext(ctx)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	default:
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket: wrong scheme %s", u.Scheme)
+	}
+
+	ws, err := webSocketHandshake(ctx, conn, u, rnd)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("WebSocket: %s", err)
+	}
+	return ws, nil
+}
+
+func webSocketHandshake(ctx context.Context, conn net.Conn, u *url.URL, rnd io.Reader) (*wsConn, error) {
+	key := make([]byte, 16)
+	_, err := io.ReadFull(rnd, key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := base64.StdEncoding.EncodeToString(key)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.Scheme = "http"
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", nonce)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Protocol", "binary")
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+	err = req.Write(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, fmt.Errorf("handshake failed: %s", resp.Status)
+	}
+	if resp.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(nonce) {
+		return nil, errors.New("wrong Sec-WebSocket-Accept")
+	}
+	return newWSConn(conn, br, rnd), nil
+}
+
+func webSocketAccept(nonce string) string {
+	sum := sha1lib.Sum([]byte(nonce + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// wsConn reads and writes binary messages of the WebSocket as a stream
+// Client frames are masked, server frames are not
+type wsConn struct {
+	net.Conn
+	br     *bufio.Reader
+	client bool
+	rnd    io.Reader // source of the masks of client frames
+
+	writeMutex sync.Mutex
+	payload    []byte // unread part of the current message
+}
+
+// newWSConn makes the client side of the connection when rnd is not nil
+func newWSConn(conn net.Conn, br *bufio.Reader, rnd io.Reader) *wsConn {
+	return &wsConn{Conn: conn, br: br, client: rnd != nil, rnd: rnd}
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for len(c.payload) == 0 {
+		err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, c.payload)
+	c.payload = c.payload[n:]
+	return n, nil
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	err := c.writeFrame(wsOpBinary, b)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close sends the close frame and closes the connection
+// A Write stuck on a stalled connection holds writeMutex, the close frame is skipped then
+// and closing the connection unblocks the Write
+func (c *wsConn) Close() error {
+	if c.writeMutex.TryLock() {
+		frame, err := c.frame(wsOpClose, nil)
+		if err == nil {
+			_ = c.Conn.SetWriteDeadline(time.Now().Add(wsCloseTimeout))
+			_, _ = c.Conn.Write(frame)
+		}
+		c.writeMutex.Unlock()
+	}
+	return c.Conn.Close()
+}
+
+// readFrame reads the next frame, control frames are handled here
+func (c *wsConn) readFrame() error {
+	header := make([]byte, 2)
+	_, err := io.ReadFull(c.br, header)
+	if err != nil {
+		return err
+	}
+	opcode := header[0] & 0x0f
+	masked := header[1]&0x80 != 0
+	size := uint64(header[1] & 0x7f)
+	switch size {
+	case 126:
+		ext := make([]byte, 2)
+		if _, err = io.ReadFull(c.br, ext); err != nil {
+			return err
+		}
+		size = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		ext := make([]byte, 8)
+		if _, err = io.ReadFull(c.br, ext); err != nil {
+			return err
+		}
+		size = binary.BigEndian.Uint64(ext)
+	}
+	if size > maxPacketSize {
+		return fmt.Errorf("WebSocket: frame is too big: %d", size)
+	}
+	var mask []byte
+	if masked {
+		mask = make([]byte, 4)
+		if _, err = io.ReadFull(c.br, mask); err != nil {
+			return err
+		}
+	}
+	payload := make([]byte, size)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return err
+	}
+	for i := range mask {
+		for j := i; j < len(payload); j += 4 {
+			payload[j] ^= mask[i]
+		}
+	}
+
+	switch opcode {
+	case wsOpBinary, wsOpContinuation:
+		c.payload = payload
+	case wsOpPing:
+		return c.writeFrame(wsOpPong, payload)
+	case wsOpPong:
+	case wsOpClose:
+		return io.EOF
+	default:
+		return fmt.Errorf("WebSocket: unexpected opcode %d", opcode)
+	}
+	return nil
+}
+
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	frame, err := c.frame(opcode, payload)
+	if err != nil {
+		return err
+	}
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+	_, err = c.Conn.Write(frame)
+	return err
+}
+
+// frame makes a frame of one message, client frames get a mask from rnd
+func (c *wsConn) frame(opcode byte, payload []byte) ([]byte, error) {
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|opcode)
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xffff:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+	if c.client {
+		mask := make([]byte, 4)
+		_, err := io.ReadFull(c.rnd, mask)
+		if err != nil {
+			return nil, err
+		}
+		frame = append(frame, mask...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range frame[start:] {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	return frame, nil
+}
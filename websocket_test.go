@@ -0,0 +1,125 @@
+package mtproto
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// webSocketServer accepts one WebSocket client and runs obfuscated2 echo on it
+func webSocketServer(l net.Listener, inner Transport) error {
+	conn, err := l.Accept()
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReader(conn)
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return err
+	}
+	if req.URL.Path != "/apiws" || req.Header.Get("Upgrade") != "websocket" ||
+		req.Header.Get("Sec-WebSocket-Protocol") != "binary" {
+		conn.Close()
+		return errors.New("wrong handshake request")
+	}
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Protocol: binary\r\n" +
+		"Sec-WebSocket-Accept: " + webSocketAccept(req.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"
+	if _, err = conn.Write([]byte(resp)); err != nil {
+		return err
+	}
+
+	ws := newWSConn(conn, br, nil)
+	// the client must answer pings without breaking the stream
+	if err = ws.writeFrame(wsOpPing, []byte("ping")); err != nil {
+		return err
+	}
+	return obfuscatedEcho(ws, inner, nil, 0)
+}
+
+func TestWebSocketTransport(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	done := make(chan error, 1)
+	go func() {
+		done <- webSocketServer(l, NewIntermediateTransport(rand.Reader))
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := dialWebSocket(ctx, &net.Dialer{}, "ws://"+l.Addr().String()+"/apiws", rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := NewObfuscatedTransport(NewIntermediateTransport)(rand.Reader)
+	if err = transport.Init(conn); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range [][]byte{bytes.Repeat([]byte{1, 2, 3, 4}, 10), bytes.Repeat([]byte{4, 3, 2, 1}, 20000)} {
+		if err = transport.WritePacket(conn, p); err != nil {
+			t.Fatal(err)
+		}
+		got, err := transport.ReadPacket(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, p) {
+			t.Errorf("echo mismatch, %d bytes", len(got))
+		}
+	}
+	conn.Close()
+	if err = <-done; err != io.EOF {
+		t.Errorf("server: %v", err)
+	}
+
+	if WebSocketEndpoint(4) != "wss://vesta.web.telegram.org/apiws" {
+		t.Error(WebSocketEndpoint(4))
+	}
+	if WebSocketTestEndpoint(2) != "wss://venus.web.telegram.org/apiws_test" {
+		t.Error(WebSocketTestEndpoint(2))
+	}
+}
+
+func TestWebSocketCloseStalled(t *testing.T) {
+	// nobody reads the other end of the pipe, so every write stalls
+	client, server := net.Pipe()
+	defer server.Close()
+	ws := newWSConn(client, nil, rand.Reader)
+	written := make(chan error, 1)
+	go func() {
+		_, err := ws.Write([]byte{1, 2, 3, 4})
+		written <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- ws.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(2 * wsCloseTimeout):
+		t.Fatal("Close waits for the stalled Write")
+	}
+	if err := <-written; err == nil {
+		t.Error("stalled Write succeeded after Close")
+	}
+
+	// without a pending Write the close frame is tried for wsCloseTimeout at most
+	client, server = net.Pipe()
+	defer server.Close()
+	ws = newWSConn(client, nil, rand.Reader)
+	start := time.Now()
+	_ = ws.Close()
+	if d := time.Since(start); d > 2*wsCloseTimeout {
+		t.Errorf("Close took %s", d)
+	}
+}